@@ -0,0 +1,128 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinf "k8s.io/client-go/informers"
+	corecli "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imageauth.Flags().StringP("namespace", "n", "", "namespace to use")
+	imageauth.Flags().String(
+		"operator-namespace", "tagger", "namespace hosting the operator config",
+	)
+}
+
+var imageauth = &cobra.Command{
+	Use:     "auth -n <namespace> <image name>",
+	Short:   "Shows which authentications would be used to import an Image",
+	Long:    static.Text["auth_help_header"],
+	Example: static.Text["auth_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		opns, err := c.Flags().GetString("operator-namespace")
+		if err != nil {
+			return err
+		}
+
+		// the services read the operator config from the namespace pointed at by
+		// POD_NAMESPACE, inside the operator pod that is always bound. Out here we
+		// set it by hand so mirror and internal registry settings are honored.
+		os.Setenv("POD_NAMESPACE", opns)
+
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		corcli, err := corecli.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("error creating core client: %w", err)
+		}
+		corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+		imgcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		syssvc := services.NewSysContext(corinf)
+
+		corinf.Start(ctx.Done())
+		if !cache.WaitForCacheSync(
+			ctx.Done(),
+			corinf.Core().V1().Secrets().Informer().HasSynced,
+			corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+		) {
+			return fmt.Errorf("errors waiting for caches to sync")
+		}
+
+		img, err := imgcli.TaggerV1beta1().Images(ns).Get(
+			ctx, args[0], metav1.GetOptions{},
+		)
+		if err != nil {
+			return fmt.Errorf("error getting image: %w", err)
+		}
+
+		from := img.Spec.From
+		if !imgv1b1.TaggedReference(from) {
+			from = fmt.Sprintf("%s:%s", from, syssvc.DefaultTagFor(ns))
+		}
+
+		imgref, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", from))
+		if err != nil {
+			return fmt.Errorf("invalid image source reference: %w", err)
+		}
+
+		sources, err := syssvc.AuthSourcesFor(ctx, imgref, ns)
+		if err != nil {
+			return fmt.Errorf("error resolving authentications: %w", err)
+		}
+
+		fmt.Printf("source: %s\n", from)
+		fmt.Println("authentications (in attempt order):")
+		for i, src := range sources {
+			if src.Secret != "" {
+				fmt.Printf("%d. %s %s/%s\n", i+1, src.Type, ns, src.Secret)
+				continue
+			}
+			fmt.Printf("%d. %s\n", i+1, src.Type)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	coreinf "k8s.io/client-go/informers"
+	corecli "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imagecheck.Flags().StringP("namespace", "n", "", "namespace to use")
+	imagecheck.Flags().Bool("insecure", false, "skip tls check for the remote registry")
+	imagecheck.Flags().String(
+		"operator-namespace", "tagger", "namespace hosting the operator config",
+	)
+}
+
+var imagecheck = &cobra.Command{
+	Use:     "check -n <namespace> <image reference>",
+	Short:   "Validates an image reference against the configured policies",
+	Long:    static.Text["check_help_header"],
+	Example: static.Text["check_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image reference")
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		insecure, err := c.Flags().GetBool("insecure")
+		if err != nil {
+			return err
+		}
+
+		opns, err := c.Flags().GetString("operator-namespace")
+		if err != nil {
+			return err
+		}
+
+		// the services read the operator config from the namespace pointed at by
+		// POD_NAMESPACE, inside the operator pod that is always bound. Out here we
+		// set it by hand so the same policies the operator enforces apply to this
+		// preflight as well.
+		os.Setenv("POD_NAMESPACE", opns)
+
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		corcli, err := corecli.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("error creating core client: %w", err)
+		}
+		corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+		syssvc := services.NewSysContext(corinf)
+		impsvc := services.NewImageImport(corinf, nil, nil)
+
+		corinf.Start(ctx.Done())
+		if !cache.WaitForCacheSync(
+			ctx.Done(),
+			corinf.Core().V1().Secrets().Informer().HasSynced,
+			corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+		) {
+			return fmt.Errorf("errors waiting for caches to sync")
+		}
+
+		// apply the same normalization we run during imports, references without
+		// a tag or digest get the configured default tag appended.
+		from := args[0]
+		if !imgv1b1.TaggedReference(from) {
+			from = fmt.Sprintf("%s:%s", from, syssvc.DefaultTagFor(ns))
+		}
+
+		imgref, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", from))
+		if err != nil {
+			return fmt.Errorf("invalid image reference: %w", err)
+		}
+
+		sysctxs, err := syssvc.SystemContextsFor(ctx, imgref, ns, insecure)
+		if err != nil {
+			return fmt.Errorf("error resolving credentials: %w", err)
+		}
+
+		fmt.Printf("checking %s\n", from)
+		imghash, _, _, _, err := impsvc.HashReferenceByImage(ctx, imgref, sysctxs, "", 0)
+		if err != nil {
+			fmt.Println("verdict: rejected")
+			return err
+		}
+
+		fmt.Printf("resolved: %s\n", imghash.DockerReference().String())
+		fmt.Println("verdict: accepted")
+		return nil
+	},
+}
@@ -16,10 +16,8 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
-	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
 	itagcli "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
@@ -34,14 +32,14 @@ func init() {
 }
 
 var imageimport = &cobra.Command{
-	Use:     "import --from docker.io/library/centos -n <namespace> <image name>",
+	Use:     "import --from docker.io/library/centos -n <namespace> [image name]",
 	Short:   "Imports an Image",
 	Long:    static.Text["import_help_header"],
 	Example: static.Text["import_help_examples"],
 	RunE: func(c *cobra.Command, args []string) error {
 		ctx := c.Context()
-		if len(args) != 1 {
-			return fmt.Errorf("provide an image name")
+		if len(args) > 1 {
+			return fmt.Errorf("provide a single image name")
 		}
 
 		ns, err := namespace(c)
@@ -54,6 +52,18 @@ var imageimport = &cobra.Command{
 			return err
 		}
 
+		// when no image name is provided we derive one from the source
+		// reference, handy when importing many images in bulk.
+		var name string
+		if len(args) == 1 {
+			name = args[0]
+		} else if from != "" {
+			name = services.ImageNameForReference(from)
+		}
+		if name == "" {
+			return fmt.Errorf("provide an image name or a source through --from")
+		}
+
 		mirror, err := c.Flags().GetBool("mirror")
 		if err != nil {
 			return err
@@ -71,7 +81,7 @@ var imageimport = &cobra.Command{
 
 		opts := services.ImportOpts{
 			Namespace:   ns,
-			TargetImage: args[0],
+			TargetImage: name,
 			From:        from,
 			Mirror:      &mirror,
 			Insecure:    &ins,
@@ -88,11 +98,9 @@ var imageimport = &cobra.Command{
 }
 
 func createImageImportService() (*services.ImageImport, error) {
-	cfgpath := os.Getenv("KUBECONFIG")
-
-	config, err := clientcmd.BuildConfigFromFlags("", cfgpath)
+	config, err := restConfig()
 	if err != nil {
-		return nil, fmt.Errorf("error building config: %s", err)
+		return nil, err
 	}
 
 	tagcli, err := itagcli.NewForConfig(config)
@@ -16,11 +16,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"os/signal"
 	"path"
 	"syscall"
 
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
 	"github.com/containers/storage/pkg/reexec"
@@ -44,7 +46,11 @@ func main() {
 		Use:          "kubectl-image",
 		SilenceUsage: true,
 	}
-	root.AddCommand(imageversion, imageimport, imagepush, imagepull)
+	root.AddCommand(
+		imageversion, imageimport, imagepush, imagepull, imagepromote,
+		imagesetsource, imagecheck, imagestats, imageauth, imageverifymirror,
+		imagerollback, imagerun, imagereconcile, imageapprove,
+	)
 	root.ExecuteContext(ctx)
 }
 
@@ -63,6 +69,36 @@ func namespace(c *cobra.Command) (string, error) {
 	return cfg.Contexts[cfg.CurrentContext].Namespace, nil
 }
 
+// restConfig creates a rest config for the cluster. The path set through the KUBECONFIG
+// environment variable is honored when present, otherwise the default loading rules apply
+// (~/.kube/config among others) falling back to the in-cluster config when running from
+// within a pod. Errors out with an actionable message when no configuration can be found.
+func restConfig() (*rest.Config, error) {
+	if cfgpath := os.Getenv("KUBECONFIG"); cfgpath != "" {
+		config, err := clientcmd.BuildConfigFromFlags("", cfgpath)
+		if err != nil {
+			return nil, fmt.Errorf("error building config from %s: %w", cfgpath, err)
+		}
+		return config, nil
+	}
+
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, nil,
+	).ClientConfig(); err == nil {
+		return config, nil
+	}
+
+	if config, err := rest.InClusterConfig(); err == nil {
+		return config, nil
+	}
+
+	return nil, fmt.Errorf(
+		"no kubernetes configuration found: set KUBECONFIG, create a kubeconfig " +
+			"file at ~/.kube/config or run this command from within a pod",
+	)
+}
+
 // createHomeTempDir creates a directory in user's home directory. Creates and return a
 // fs.FS handler using the created directory.
 func createHomeTempDir() (*fs.FS, error) {
@@ -0,0 +1,101 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	itagcli "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imagepromote.Flags().StringP("namespace", "n", "", "namespace to use")
+	imagepromote.Flags().String("to-namespace", "", "namespace to promote the image to")
+	imagepromote.Flags().Duration(
+		"stable-for", 0,
+		"only promote if the source reference has not changed for this long",
+	)
+}
+
+var imagepromote = &cobra.Command{
+	Use:     "promote --to-namespace prod -n <namespace> <image name>",
+	Short:   "Promotes an Image into another namespace",
+	Long:    static.Text["promote_help_header"],
+	Example: static.Text["promote_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+
+		srcns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		dstns, err := c.Flags().GetString("to-namespace")
+		if err != nil {
+			return err
+		}
+		if dstns == "" {
+			return fmt.Errorf("provide a destination namespace (--to-namespace)")
+		}
+
+		stablefor, err := c.Flags().GetDuration("stable-for")
+		if err != nil {
+			return err
+		}
+
+		tagcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		// we create an ImageImport in the destination namespace pointing to the
+		// image currently hosted in our mirror registry. The operator then runs
+		// a mirror to mirror copy, no image data flows through this client. By
+		// creating the object through the api we also get RBAC on the target
+		// namespace validated for free.
+		tisvc := services.NewImage(nil, tagcli, nil)
+		ti, err := tisvc.Promote(
+			ctx, services.PromoteOpts{
+				SourceNamespace: srcns,
+				TargetNamespace: dstns,
+				Name:            args[0],
+				StableFor:       stablefor,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to create image import: %w", err)
+		}
+
+		fmt.Printf("new image import request created: %s/%s\n", dstns, ti.Name)
+		return nil
+	},
+}
+
+// createImageClient returns a clientset capable of handling Image and ImageImport objects.
+func createImageClient() (itagcli.Interface, error) {
+	config, err := restConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return itagcli.NewForConfig(config)
+}
@@ -18,9 +18,6 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
-	"os"
-
-	"k8s.io/client-go/tools/clientcmd"
 
 	imgcopy "github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/signature"
@@ -54,7 +51,7 @@ var imagepull = &cobra.Command{
 			return err
 		}
 
-		config, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+		config, err := restConfig()
 		if err != nil {
 			return err
 		}
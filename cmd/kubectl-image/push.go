@@ -20,8 +20,6 @@ import (
 	"fmt"
 	"os"
 
-	"k8s.io/client-go/tools/clientcmd"
-
 	imgcopy "github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
@@ -36,6 +34,9 @@ import (
 
 func init() {
 	imagepush.Flags().Bool("insecure", false, "don't verify certificate when connecting")
+	imagepush.Flags().Int(
+		"chunk-size", pb.DefaultChunkSize, "chunk size (in bytes) used when sending the image",
+	)
 }
 
 var imagepush = &cobra.Command{
@@ -53,7 +54,12 @@ var imagepush = &cobra.Command{
 			return err
 		}
 
-		config, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+		chunksz, err := c.Flags().GetInt("chunk-size")
+		if err != nil {
+			return err
+		}
+
+		config, err := restConfig()
 		if err != nil {
 			return err
 		}
@@ -77,7 +83,7 @@ var imagepush = &cobra.Command{
 		defer cleanup()
 
 		return pushImage(
-			c.Context(), tidx, srcref, config.BearerToken, insecure,
+			c.Context(), tidx, srcref, config.BearerToken, insecure, chunksz,
 		)
 	},
 }
@@ -131,7 +137,12 @@ func saveImage(ctx context.Context, tidx imageindex) (*os.File, func(), error) {
 
 // pushImages sends an image through GRPC to a tagger instance.
 func pushImage(
-	ctx context.Context, idx imageindex, from *os.File, token string, insecure bool,
+	ctx context.Context,
+	idx imageindex,
+	from *os.File,
+	token string,
+	insecure bool,
+	chunksz int,
 ) error {
 	conn, err := grpc.DialContext(
 		ctx, idx.server, grpc.WithTransportCredentials(
@@ -178,7 +189,7 @@ func pushImage(
 	pbar.SetMax(fsize)
 	defer pbar.Wait()
 
-	if err := pb.Send(from, fsize, stream, pbar); err != nil {
+	if err := pb.Send(from, fsize, stream, pbar, pb.WithChunkSize(chunksz)); err != nil {
 		pbar.Abort()
 		if _, nerr := stream.CloseAndRecv(); err != nil {
 			return nerr
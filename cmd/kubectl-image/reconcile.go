@@ -0,0 +1,87 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+)
+
+func init() {
+	imagereconcile.Flags().StringP("namespace", "n", "", "namespace to use")
+}
+
+var imagereconcile = &cobra.Command{
+	Use:     "reconcile -n <namespace> <image name>",
+	Short:   "Forces an immediate reconcile of an Image",
+	Long:    static.Text["reconcile_help_header"],
+	Example: static.Text["reconcile_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		tagcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		img, err := tagcli.TaggerV1beta1().Images(ns).Get(
+			ctx, args[0], metav1.GetOptions{},
+		)
+		if err != nil {
+			return fmt.Errorf("error getting image: %w", err)
+		}
+
+		// any change to the annotation bumps the object's resource version,
+		// waking up the operator through its informer.
+		if img.Annotations == nil {
+			img.Annotations = map[string]string{}
+		}
+		img.Annotations[imgv1b1.ReconcileRequestAnnotation] = time.Now().Format(
+			time.ANSIC,
+		)
+		if _, err := tagcli.TaggerV1beta1().Images(ns).Update(
+			ctx, img, metav1.UpdateOptions{},
+		); err != nil {
+			return fmt.Errorf("error updating image: %w", err)
+		}
+		fmt.Printf("reconcile requested for image %s/%s\n", ns, img.Name)
+
+		if ref := img.CurrentReferenceForImage(); len(ref) > 0 {
+			fmt.Printf("current reference: %s\n", ref)
+		} else {
+			fmt.Println("current reference: none (not imported yet)")
+		}
+		fmt.Printf("known references:  %d\n", len(img.Status.HashReferences))
+		if failures := len(img.Status.RecentFailures); failures > 0 {
+			fmt.Printf("recent failures:   %d\n", failures)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imagerollback.Flags().StringP("namespace", "n", "", "namespace to use")
+}
+
+var imagerollback = &cobra.Command{
+	Use:     "rollback -n <namespace> <image name>",
+	Short:   "Rolls an Image back to its previous generation",
+	Long:    static.Text["rollback_help_header"],
+	Example: static.Text["rollback_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		tagcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		// the rollback happens by means of a new ImageImport pointing to the
+		// previous reference, the operator processes it as any other import.
+		tisvc := services.NewImage(nil, tagcli, nil)
+		ti, err := tisvc.Rollback(ctx, ns, args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("new image import request created: %s/%s\n", ns, ti.Name)
+		return nil
+	},
+}
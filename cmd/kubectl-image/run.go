@@ -0,0 +1,182 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corecli "k8s.io/client-go/kubernetes"
+	"k8s.io/utils/pointer"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	itagcli "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imagerun.Flags().StringP("namespace", "n", "", "namespace to use")
+	imagerun.Flags().String("from", "", "image source reference")
+	imagerun.Flags().Bool("mirror", false, "mirror the image into our mirror registry")
+	imagerun.Flags().Duration("timeout", 5*time.Minute, "how long to wait for the import")
+}
+
+var imagerun = &cobra.Command{
+	Use:     "run --from <image ref> -n <namespace> <image name>",
+	Short:   "Imports an image and creates a Deployment using it",
+	Long:    static.Text["run_help_header"],
+	Example: static.Text["run_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+		name := args[0]
+
+		from, err := c.Flags().GetString("from")
+		if err != nil {
+			return err
+		}
+		if from == "" {
+			return fmt.Errorf("provide a source through --from")
+		}
+
+		mirror, err := c.Flags().GetBool("mirror")
+		if err != nil {
+			return err
+		}
+
+		timeout, err := c.Flags().GetDuration("timeout")
+		if err != nil {
+			return err
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		corcli, err := corecli.NewForConfig(config)
+		if err != nil {
+			return err
+		}
+
+		tagcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		tisvc := services.NewImage(nil, tagcli, nil)
+		img, err := tisvc.NewImage(
+			ctx, services.NewImageOpts{
+				Namespace: ns,
+				Name:      name,
+				From:      from,
+				Mirror:    mirror,
+			},
+		)
+		if err != nil {
+			return fmt.Errorf("unable to create image: %w", err)
+		}
+		fmt.Printf("image created: %s/%s\n", ns, img.Name)
+
+		imgref, err := waitForImport(ctx, tagcli, ns, name, timeout)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("image imported: %s\n", imgref)
+
+		dep, err := createDeploymentFor(ctx, corcli, ns, name, imgref)
+		if err != nil {
+			return fmt.Errorf("unable to create deployment: %w", err)
+		}
+
+		fmt.Printf("deployment created: %s/%s\n", ns, dep.Name)
+		return nil
+	},
+}
+
+// waitForImport polls the Image until its first import finishes, returning the imported
+// reference. The wait is bounded by the provided timeout.
+func waitForImport(
+	ctx context.Context, tagcli itagcli.Interface, ns, name string, timeout time.Duration,
+) (string, error) {
+	var imgref string
+	if err := wait.PollImmediate(
+		time.Second, timeout,
+		func() (bool, error) {
+			img, err := tagcli.TaggerV1beta1().Images(ns).Get(
+				ctx, name, metav1.GetOptions{},
+			)
+			if err != nil {
+				return false, err
+			}
+			imgref = img.CurrentReferenceForImage()
+			return len(imgref) > 0, nil
+		},
+	); err != nil {
+		return "", fmt.Errorf("error waiting for image import: %w", err)
+	}
+	return imgref, nil
+}
+
+// createDeploymentFor creates a minimal Deployment running provided image reference. The
+// deployment is annotated for automatic imports so later pushes to the source keep being
+// tracked by the operator.
+func createDeploymentFor(
+	ctx context.Context, corcli corecli.Interface, ns, name, imgref string,
+) (*appsv1.Deployment, error) {
+	labels := map[string]string{"app": name}
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				services.AutoImportAnnotation: "true",
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: pointer.Int32(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: labels,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:  name,
+							Image: imgref,
+						},
+					},
+				},
+			},
+		},
+	}
+	return corcli.AppsV1().Deployments(ns).Create(ctx, dep, metav1.CreateOptions{})
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+)
+
+func init() {
+	imagesetsource.Flags().StringP("namespace", "n", "", "namespace to use")
+	imagesetsource.Flags().StringP("from", "f", "", "new image source")
+	imagesetsource.Flags().Bool("mirror", false, "mirror the image")
+}
+
+var imagesetsource = &cobra.Command{
+	Use:     "set-source --from docker.io/library/centos -n <namespace> <image name>",
+	Short:   "Updates the source of an Image in place",
+	Long:    static.Text["setsource_help_header"],
+	Example: static.Text["setsource_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+		if len(args) != 1 {
+			return fmt.Errorf("provide an image name")
+		}
+
+		ns, err := namespace(c)
+		if err != nil {
+			return err
+		}
+
+		from, err := c.Flags().GetString("from")
+		if err != nil {
+			return err
+		}
+		if from == "" {
+			return fmt.Errorf("provide a new image source (--from)")
+		}
+
+		// validates the new source using the same parsing we run during an
+		// import, there is no point in repointing an Image towards a source
+		// the operator won't be able to parse later on.
+		refstr := fmt.Sprintf("docker://%s", from)
+		if _, err := alltransports.ParseImageName(refstr); err != nil {
+			return fmt.Errorf("invalid image source reference: %w", err)
+		}
+
+		tagcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+
+		img, err := tagcli.TaggerV1beta1().Images(ns).Get(
+			ctx, args[0], metav1.GetOptions{},
+		)
+		if err != nil {
+			return fmt.Errorf("error getting image: %w", err)
+		}
+
+		img.Spec.From = from
+		if c.Flags().Changed("mirror") {
+			mirror, err := c.Flags().GetBool("mirror")
+			if err != nil {
+				return err
+			}
+			img.Spec.Mirror = mirror
+		}
+
+		img, err = tagcli.TaggerV1beta1().Images(ns).Update(
+			ctx, img, metav1.UpdateOptions{},
+		)
+		if err != nil {
+			return fmt.Errorf("error updating image: %w", err)
+		}
+
+		buf, err := json.MarshalIndent(img, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding image: %w", err)
+		}
+
+		fmt.Println(string(buf))
+		return nil
+	},
+}
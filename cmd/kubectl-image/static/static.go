@@ -38,13 +38,93 @@ var import_help_header string
 //go:embed "src/import_help_examples"
 var import_help_examples string
 
+//go:embed "src/promote_help_header"
+var promote_help_header string
+
+//go:embed "src/promote_help_examples"
+var promote_help_examples string
+
+//go:embed "src/setsource_help_header"
+var setsource_help_header string
+
+//go:embed "src/setsource_help_examples"
+var setsource_help_examples string
+
+//go:embed "src/check_help_header"
+var check_help_header string
+
+//go:embed "src/check_help_examples"
+var check_help_examples string
+
+//go:embed "src/stats_help_header"
+var stats_help_header string
+
+//go:embed "src/stats_help_examples"
+var stats_help_examples string
+
+//go:embed "src/auth_help_header"
+var auth_help_header string
+
+//go:embed "src/auth_help_examples"
+var auth_help_examples string
+
+//go:embed "src/rollback_help_header"
+var rollback_help_header string
+
+//go:embed "src/rollback_help_examples"
+var rollback_help_examples string
+
+//go:embed "src/run_help_header"
+var run_help_header string
+
+//go:embed "src/run_help_examples"
+var run_help_examples string
+
+//go:embed "src/approve_help_header"
+var approve_help_header string
+
+//go:embed "src/approve_help_examples"
+var approve_help_examples string
+
+//go:embed "src/reconcile_help_header"
+var reconcile_help_header string
+
+//go:embed "src/reconcile_help_examples"
+var reconcile_help_examples string
+
+//go:embed "src/verifymirror_help_header"
+var verifymirror_help_header string
+
+//go:embed "src/verifymirror_help_examples"
+var verifymirror_help_examples string
+
 // Text is a map to all embed text files, indexed by their respective
 // path relative to "src" directory.
 var Text = map[string]string{
-	"pull_help_header":     pull_help_header,
-	"pull_help_examples":   pull_help_examples,
-	"push_help_header":     push_help_header,
-	"push_help_examples":   push_help_examples,
-	"import_help_header":   import_help_header,
-	"import_help_examples": import_help_examples,
+	"pull_help_header":           pull_help_header,
+	"pull_help_examples":         pull_help_examples,
+	"push_help_header":           push_help_header,
+	"push_help_examples":         push_help_examples,
+	"import_help_header":         import_help_header,
+	"import_help_examples":       import_help_examples,
+	"promote_help_header":        promote_help_header,
+	"promote_help_examples":      promote_help_examples,
+	"setsource_help_header":      setsource_help_header,
+	"setsource_help_examples":    setsource_help_examples,
+	"check_help_header":          check_help_header,
+	"check_help_examples":        check_help_examples,
+	"stats_help_header":          stats_help_header,
+	"stats_help_examples":        stats_help_examples,
+	"auth_help_header":           auth_help_header,
+	"auth_help_examples":         auth_help_examples,
+	"approve_help_header":        approve_help_header,
+	"approve_help_examples":      approve_help_examples,
+	"reconcile_help_header":      reconcile_help_header,
+	"reconcile_help_examples":    reconcile_help_examples,
+	"run_help_header":            run_help_header,
+	"run_help_examples":          run_help_examples,
+	"rollback_help_header":       rollback_help_header,
+	"rollback_help_examples":     rollback_help_examples,
+	"verifymirror_help_header":   verifymirror_help_header,
+	"verifymirror_help_examples": verifymirror_help_examples,
 }
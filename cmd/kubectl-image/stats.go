@@ -0,0 +1,101 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	coreinf "k8s.io/client-go/informers"
+	corecli "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imagestats.Flags().String(
+		"operator-namespace", "tagger", "namespace hosting the operator config",
+	)
+}
+
+var imagestats = &cobra.Command{
+	Use:     "stats",
+	Short:   "Reports layer sharing statistics for mirrored images",
+	Long:    static.Text["stats_help_header"],
+	Example: static.Text["stats_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+
+		opns, err := c.Flags().GetString("operator-namespace")
+		if err != nil {
+			return err
+		}
+
+		// the mirror registry configuration is read from the namespace pointed at
+		// by POD_NAMESPACE, inside the operator pod that is always bound. Out here
+		// we set it by hand so we talk to the same mirror the operator uses.
+		os.Setenv("POD_NAMESPACE", opns)
+
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		corcli, err := corecli.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("error creating core client: %w", err)
+		}
+		corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+		imgcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+		imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+		imgsvc := services.NewImage(corinf, imgcli, imginf)
+
+		corinf.Start(ctx.Done())
+		imginf.Start(ctx.Done())
+		if !cache.WaitForCacheSync(
+			ctx.Done(),
+			corinf.Core().V1().Secrets().Informer().HasSynced,
+			corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+		) {
+			return fmt.Errorf("errors waiting for caches to sync")
+		}
+
+		stats, err := imgsvc.MirrorLayerStats(ctx)
+		if err != nil {
+			return fmt.Errorf("error computing layer stats: %w", err)
+		}
+
+		fmt.Printf("mirrored images: %d\n", stats.Images)
+		fmt.Printf("total layers:    %d\n", stats.TotalLayers)
+		fmt.Printf("unique layers:   %d\n", stats.UniqueLayers)
+		if stats.UniqueLayers > 0 {
+			ratio := float64(stats.TotalLayers) / float64(stats.UniqueLayers)
+			fmt.Printf("dedup ratio:     %.2f\n", ratio)
+		}
+		return nil
+	},
+}
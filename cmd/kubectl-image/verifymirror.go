@@ -0,0 +1,113 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	coreinf "k8s.io/client-go/informers"
+	corecli "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ricardomaraschini/tagger/cmd/kubectl-image/static"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+	"github.com/ricardomaraschini/tagger/services"
+)
+
+func init() {
+	imageverifymirror.Flags().StringP(
+		"namespace", "n", "", "restrict verification to images in this namespace",
+	)
+	imageverifymirror.Flags().String(
+		"operator-namespace", "tagger", "namespace hosting the operator config",
+	)
+}
+
+var imageverifymirror = &cobra.Command{
+	Use:     "verify-mirror",
+	Short:   "Verifies mirrored image references still resolve in the mirror",
+	Long:    static.Text["verifymirror_help_header"],
+	Example: static.Text["verifymirror_help_examples"],
+	RunE: func(c *cobra.Command, args []string) error {
+		ctx := c.Context()
+
+		namespace, err := c.Flags().GetString("namespace")
+		if err != nil {
+			return err
+		}
+
+		opns, err := c.Flags().GetString("operator-namespace")
+		if err != nil {
+			return err
+		}
+
+		// the mirror registry configuration is read from the namespace pointed at
+		// by POD_NAMESPACE, inside the operator pod that is always bound. Out here
+		// we set it by hand so we talk to the same mirror the operator uses.
+		os.Setenv("POD_NAMESPACE", opns)
+
+		config, err := restConfig()
+		if err != nil {
+			return err
+		}
+
+		corcli, err := corecli.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("error creating core client: %w", err)
+		}
+		corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+		imgcli, err := createImageClient()
+		if err != nil {
+			return err
+		}
+		imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+		imgsvc := services.NewImage(corinf, imgcli, imginf)
+
+		corinf.Start(ctx.Done())
+		imginf.Start(ctx.Done())
+		if !cache.WaitForCacheSync(
+			ctx.Done(),
+			corinf.Core().V1().Secrets().Informer().HasSynced,
+			corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+		) {
+			return fmt.Errorf("errors waiting for caches to sync")
+		}
+
+		drifts, err := imgsvc.VerifyMirror(ctx, namespace)
+		if err != nil {
+			return fmt.Errorf("error verifying mirror: %w", err)
+		}
+
+		if len(drifts) == 0 {
+			fmt.Println("all mirrored image references resolve in the mirror")
+			return nil
+		}
+
+		for _, drift := range drifts {
+			fmt.Printf(
+				"%s/%s: %s: %s\n",
+				drift.Namespace, drift.Name, drift.Reference, drift.Reason,
+			)
+		}
+		return fmt.Errorf("%d mirrored image references do not resolve", len(drifts))
+	},
+}
@@ -41,6 +41,9 @@ var Version = "v0.0.0"
 
 func main() {
 	klog.InitFlags(nil)
+	readonly := flag.Bool(
+		"read-only", false, "run in read-only standby mode (no writes are made)",
+	)
 	flag.Parse()
 
 	ctx, stop := signal.NotifyContext(
@@ -80,17 +83,24 @@ func main() {
 	corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
 
 	// create our service layer
+	services.ImporterVersion = Version
 	impsvc := services.NewImageImport(corinf, imgcli, imginf)
 	imgsvc := services.NewImage(corinf, imgcli, imginf)
 	tiosvc := services.NewImageIO(corinf, imgcli, imginf)
+	depsvc := services.NewDeployment(corinf, imgcli, imginf)
+	lstsvc := services.NewImageList(corinf, imgcli, imginf)
 	usrsvc := services.NewUser(corcli)
+	syssvc := services.NewSysContext(corinf)
 
 	// create controller layer
 	imctrl := controllers.NewImageImport(impsvc)
 	itctrl := controllers.NewImage(imgsvc)
 	mtctrl := controllers.NewMutatingWebHook(impsvc, imgsvc)
 	tioctr := controllers.NewImageIO(tiosvc, usrsvc)
-	moctrl := controllers.NewMetric()
+	depctr := controllers.NewDeployment(depsvc)
+	lstctr := controllers.NewImageList(lstsvc)
+	prbctr := controllers.NewMirrorProbe(syssvc)
+	moctrl := controllers.NewMetric(imctrl, prbctr)
 
 	// starts up all informers and waits for their cache to sync up,
 	// only then we start the controllers i.e. start to process events
@@ -102,6 +112,7 @@ func main() {
 		ctx.Done(),
 		corinf.Core().V1().ConfigMaps().Informer().HasSynced,
 		corinf.Core().V1().Secrets().Informer().HasSynced,
+		corinf.Apps().V1().Deployments().Informer().HasSynced,
 		imginf.Tagger().V1beta1().Images().Informer().HasSynced,
 		imginf.Tagger().V1beta1().ImageImports().Informer().HasSynced,
 	) {
@@ -109,7 +120,19 @@ func main() {
 	}
 	klog.Info("caches in sync, moving on.")
 
-	st := starter.New(corcli, mtctrl, itctrl, moctrl, tioctr, imctrl)
+	// in read-only mode we keep the informer caches warm and the metrics endpoint
+	// online but start none of the controllers that write to the cluster or to the
+	// mirror registry. Leader election is skipped as well, a standby must never
+	// steal the lease from the active instance.
+	if *readonly {
+		klog.Info("running in read-only standby mode, no writes will be made")
+		if err := moctrl.Start(ctx); err != nil {
+			klog.Errorf("unable to start metrics controller: %s", err)
+		}
+		return
+	}
+
+	st := starter.New(corcli, mtctrl, itctrl, moctrl, tioctr, imctrl, depctr, lstctr, prbctr)
 	if err := st.Start(ctx, "tagger-leader-election"); err != nil {
 		klog.Errorf("unable to start controllers: %s", err)
 	}
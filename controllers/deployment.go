@@ -0,0 +1,191 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// DefaultRequeueBaseDelay is the starting delay applied when requeueing deployment events
+// that failed to process, it grows exponentially on repeated failures. Operators willing
+// to trade responsiveness for api server pressure (or the other way around) may override
+// it through the DEPLOYMENT_REQUEUE_DELAY environment variable.
+var DefaultRequeueBaseDelay = time.Second
+
+// DeploymentSyncer abstraction exists to make testing easier. You most likely wanna see
+// Deployment struct under services/deployment.go for a concrete implementation of this.
+type DeploymentSyncer interface {
+	Sync(context.Context, *appsv1.Deployment) error
+	Get(context.Context, string, string) (*appsv1.Deployment, error)
+	AddEventHandler(cache.ResourceEventHandler)
+}
+
+// Deployment controller handles events related to Deployments. It starts and receives events
+// from the informer, calling appropriate functions on our concrete services layer
+// implementation.
+type Deployment struct {
+	queue     workqueue.RateLimitingInterface
+	ratelimit workqueue.RateLimiter
+	depsvc    DeploymentSyncer
+	appctx    context.Context
+}
+
+// NewDeployment returns a new controller for Deployments. This controller creates Image
+// objects for Deployments that opted in for automatic imports. Failed events are requeued
+// starting at DEPLOYMENT_REQUEUE_DELAY (DefaultRequeueBaseDelay when unset) with a small
+// jitter on top.
+func NewDeployment(depsvc DeploymentSyncer) *Deployment {
+	basedelay := DefaultRequeueBaseDelay
+	if raw := os.Getenv("DEPLOYMENT_REQUEUE_DELAY"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			klog.Warningf("invalid DEPLOYMENT_REQUEUE_DELAY %q, using default", raw)
+		} else {
+			basedelay = parsed
+		}
+	}
+
+	ratelimit := jitteredRateLimiter{
+		workqueue.NewItemExponentialFailureRateLimiter(basedelay, time.Minute),
+	}
+	ctrl := &Deployment{
+		queue:     workqueue.NewRateLimitingQueue(ratelimit),
+		ratelimit: ratelimit,
+		depsvc:    depsvc,
+	}
+	depsvc.AddEventHandler(ctrl.handlers())
+	return ctrl
+}
+
+// jitteredRateLimiter adds a small random jitter on top of another rate limiter's delays
+// so requeues originated at the same instant do not hit the api server in lockstep.
+type jitteredRateLimiter struct {
+	workqueue.RateLimiter
+}
+
+// When returns the wrapped rate limiter delay for the item, inflated by up to ten percent.
+func (j jitteredRateLimiter) When(item interface{}) time.Duration {
+	return wait.Jitter(j.RateLimiter.When(item), 0.1)
+}
+
+// Name returns a name identifier for this controller.
+func (d *Deployment) Name() string {
+	return "deployment"
+}
+
+// RequiresLeaderElection returns if this controller requires or not a leader lease to run.
+func (d *Deployment) RequiresLeaderElection() bool {
+	return true
+}
+
+// enqueueEvent generates a key using "namespace/name" for the event received and then enqueues
+// it to be processed.
+func (d *Deployment) enqueueEvent(o interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(o)
+	if err != nil {
+		klog.Errorf("fail to enqueue event: %v : %s", o, err)
+		return
+	}
+	d.queue.AddRateLimited(key)
+}
+
+// handlers return a event handler that will be called by the informer whenever an event occurs.
+// This handler basically enqueues everything in our work queue using enqueueEvent.
+func (d *Deployment) handlers() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(o interface{}) {
+			d.enqueueEvent(o)
+		},
+		UpdateFunc: func(o, n interface{}) {
+			d.enqueueEvent(o)
+		},
+		DeleteFunc: func(o interface{}) {
+			d.enqueueEvent(o)
+		},
+	}
+}
+
+// eventProcessor reads our events calling syncDeployment for all of them.
+func (d *Deployment) eventProcessor(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		evt, end := d.queue.Get()
+		if end {
+			return
+		}
+
+		namespace, name, err := cache.SplitMetaNamespaceKey(evt.(string))
+		if err != nil {
+			klog.Errorf("invalid event received %s: %s", evt, err)
+			d.queue.Done(evt)
+			continue
+		}
+
+		klog.V(5).Infof("received event for deployment: %s", evt)
+		if err := d.syncDeployment(namespace, name); err != nil {
+			klog.Errorf("error processing deployment %s: %v", evt, err)
+			d.queue.Done(evt)
+			d.queue.AddRateLimited(evt)
+			continue
+		}
+
+		klog.V(5).Infof("event for deployment %s processed", evt)
+		d.queue.Done(evt)
+		d.queue.Forget(evt)
+	}
+}
+
+// syncDeployment process an event for a deployment.
+func (d *Deployment) syncDeployment(namespace, name string) error {
+	ctx, cancel := context.WithTimeout(d.appctx, time.Minute)
+	defer cancel()
+
+	dep, err := d.depsvc.Get(ctx, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return d.depsvc.Sync(ctx, dep)
+}
+
+// Start starts the controller's event loop.
+func (d *Deployment) Start(ctx context.Context) error {
+	// appctx is the 'keep going' context, if it is cancelled
+	// everything we might be doing should stop.
+	d.appctx = ctx
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go d.eventProcessor(&wg)
+
+	// wait until it is time to die.
+	<-d.appctx.Done()
+
+	d.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
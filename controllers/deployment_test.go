@@ -0,0 +1,59 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+type deploymentSyncerMock struct{}
+
+func (d deploymentSyncerMock) Sync(ctx context.Context, dep *appsv1.Deployment) error {
+	return nil
+}
+
+func (d deploymentSyncerMock) Get(
+	ctx context.Context, ns, name string,
+) (*appsv1.Deployment, error) {
+	return nil, nil
+}
+
+func (d deploymentSyncerMock) AddEventHandler(handler cache.ResourceEventHandler) {
+}
+
+func Test_deploymentRequeueDelay(t *testing.T) {
+	os.Setenv("DEPLOYMENT_REQUEUE_DELAY", "100ms")
+	defer os.Unsetenv("DEPLOYMENT_REQUEUE_DELAY")
+
+	ctrl := NewDeployment(deploymentSyncerMock{})
+	delay := ctrl.ratelimit.When("an-item")
+	if delay < 100*time.Millisecond || delay > 110*time.Millisecond {
+		t.Errorf("expecting jittered delay around 100ms, received %s", delay)
+	}
+
+	// invalid values fall back to the default base delay.
+	os.Setenv("DEPLOYMENT_REQUEUE_DELAY", "not-a-duration")
+	ctrl = NewDeployment(deploymentSyncerMock{})
+	delay = ctrl.ratelimit.When("another-item")
+	if delay < DefaultRequeueBaseDelay {
+		t.Errorf("expecting at least the default delay, received %s", delay)
+	}
+}
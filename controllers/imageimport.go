@@ -16,6 +16,8 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -33,17 +35,29 @@ import (
 type ImageImportSyncer interface {
 	Sync(context.Context, *imgv1b1.ImageImport) error
 	Get(context.Context, string, string) (*imgv1b1.ImageImport, error)
+	ImportTimeoutFor(*imgv1b1.ImageImport) time.Duration
 	AddEventHandler(cache.ResourceEventHandler)
 }
 
+// InflightImport holds data about an ImageImport that is being processed at this very
+// moment. Duration is only populated when snapshotting through InflightImports.
+type InflightImport struct {
+	Key      string    `json:"key"`
+	From     string    `json:"from,omitempty"`
+	Start    time.Time `json:"start"`
+	Duration string    `json:"duration,omitempty"`
+}
+
 // ImageImport controller handles events related to ImageImports. It starts and receives
 // events from the informer, calling appropriate functions on our concrete services
 // layer implementation.
 type ImageImport struct {
-	queue  workqueue.RateLimitingInterface
-	tisvc  ImageImportSyncer
-	appctx context.Context
-	tokens chan bool
+	queue    workqueue.RateLimitingInterface
+	tisvc    ImageImportSyncer
+	appctx   context.Context
+	tokens   chan bool
+	inflmtx  sync.Mutex
+	inflight map[string]*InflightImport
 }
 
 // NewImageImport returns a new controller for ImageImports. This controller runs image imports
@@ -52,9 +66,10 @@ type ImageImport struct {
 func NewImageImport(tisvc ImageImportSyncer) *ImageImport {
 	ratelimit := workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Minute)
 	ctrl := &ImageImport{
-		queue:  workqueue.NewRateLimitingQueue(ratelimit),
-		tisvc:  tisvc,
-		tokens: make(chan bool, 10),
+		queue:    workqueue.NewRateLimitingQueue(ratelimit),
+		tisvc:    tisvc,
+		tokens:   make(chan bool, 10),
+		inflight: map[string]*InflightImport{},
 	}
 	tisvc.AddEventHandler(ctrl.handlers())
 	return ctrl
@@ -97,6 +112,49 @@ func (t *ImageImport) handlers() cache.ResourceEventHandler {
 	}
 }
 
+// flagInflight registers provided key as an import being processed right now.
+func (t *ImageImport) flagInflight(key string) {
+	t.inflmtx.Lock()
+	defer t.inflmtx.Unlock()
+	t.inflight[key] = &InflightImport{Key: key, Start: time.Now()}
+}
+
+// setInflightFrom annotates an in-flight import with the source it imports from. This is
+// called once we manage to read the ImageImport object from the cluster.
+func (t *ImageImport) setInflightFrom(key, from string) {
+	t.inflmtx.Lock()
+	defer t.inflmtx.Unlock()
+	if inf, ok := t.inflight[key]; ok {
+		inf.From = from
+	}
+}
+
+// unflagInflight removes provided key from the list of imports being processed.
+func (t *ImageImport) unflagInflight(key string) {
+	t.inflmtx.Lock()
+	defer t.inflmtx.Unlock()
+	delete(t.inflight, key)
+}
+
+// InflightImports returns a snapshot of all imports being processed right now, reporting
+// for how long each one of them has been running. Entries are sorted by their keys.
+func (t *ImageImport) InflightImports() []InflightImport {
+	t.inflmtx.Lock()
+	defer t.inflmtx.Unlock()
+
+	imports := make([]InflightImport, 0, len(t.inflight))
+	for _, inf := range t.inflight {
+		entry := *inf
+		entry.Duration = time.Since(entry.Start).String()
+		imports = append(imports, entry)
+	}
+
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].Key < imports[j].Key
+	})
+	return imports
+}
+
 // eventProcessor reads our events calling syncImageImport for all of them. Uses t.tokens to
 // control how many imports are processed in parallel.
 func (t *ImageImport) eventProcessor(wg *sync.WaitGroup) {
@@ -111,7 +169,15 @@ func (t *ImageImport) eventProcessor(wg *sync.WaitGroup) {
 			return
 		}
 
-		t.tokens <- true
+		select {
+		case t.tokens <- true:
+		default:
+			// all tokens are in use, we gonna have to wait for a free one.
+			// keeping track of how often this happens tells operators when
+			// it is time to raise the concurrency limit.
+			metrics.WorkerWaits.Inc()
+			t.tokens <- true
+		}
 		running.Add(1)
 		go func() {
 			metrics.ActiveWorkers.Inc()
@@ -128,6 +194,9 @@ func (t *ImageImport) eventProcessor(wg *sync.WaitGroup) {
 				return
 			}
 
+			t.flagInflight(evt.(string))
+			defer t.unflagInflight(evt.(string))
+
 			klog.Infof("received event for image import: %s", evt)
 			if err := t.syncImageImport(namespace, name); err != nil {
 				klog.Errorf("error processing image import %s: %v", evt, err)
@@ -143,19 +212,22 @@ func (t *ImageImport) eventProcessor(wg *sync.WaitGroup) {
 	}
 }
 
-// syncImageImport process an event for an image import. A max of five minutes is allowed per
-// image import.
+// syncImageImport process an event for an image import. By default a max of five minutes is
+// allowed per image import, users may tune this per object through spec.importTimeout (the
+// value is capped at a cluster configured maximum, see the services layer).
 func (t *ImageImport) syncImageImport(namespace, name string) error {
-	ctx, cancel := context.WithTimeout(t.appctx, 5*time.Minute)
-	defer cancel()
-
-	it, err := t.tisvc.Get(ctx, namespace, name)
+	it, err := t.tisvc.Get(t.appctx, namespace, name)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			return nil
 		}
 		return err
 	}
+
+	ctx, cancel := context.WithTimeout(t.appctx, t.tisvc.ImportTimeoutFor(it))
+	defer cancel()
+
+	t.setInflightFrom(fmt.Sprintf("%s/%s", namespace, name), it.Spec.From)
 	return t.tisvc.Sync(ctx, it)
 }
 
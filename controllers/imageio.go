@@ -19,20 +19,35 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"syscall"
 	"time"
 
 	"k8s.io/klog/v2"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 
 	"github.com/ricardomaraschini/tagger/infra/fs"
 	"github.com/ricardomaraschini/tagger/infra/pb"
 	"github.com/ricardomaraschini/tagger/infra/progbar"
 )
 
+// DefaultMaxConcurrentTransfers is the number of push and pull streams we process at the
+// same time if MAX_CONCURRENT_TRANSFERS is not set. Every stream costs us a temporary tar
+// on disk plus memory, an unbounded number of them can kill the pod.
+var DefaultMaxConcurrentTransfers = 10
+
+// DefaultMinFreeDiskBytes is how much free space we require in the temp directory before
+// accepting an image push, overridable through the MIN_FREE_DISK_BYTES environment
+// variable. Pushes are assembled on disk so accepting one without room for it just moves
+// the failure to the middle of the transfer.
+var DefaultMinFreeDiskBytes = uint64(1 << 30)
+
 // ImagePusherPuller is here to make tests easier. You may be looking
 // for its concrete implementation in services/imageio.go. The goal of
 // an ImagePusherPuller is to allow us to Push and Pull images to and
@@ -52,11 +67,13 @@ type UserValidator interface {
 // ImageIO handles requests for pulling and pushing current image pointed
 // by a Image.
 type ImageIO struct {
-	bind   string
-	imgexp ImagePusherPuller
-	usrval UserValidator
-	srv    *grpc.Server
-	fs     *fs.FS
+	bind      string
+	imgexp    ImagePusherPuller
+	usrval    UserValidator
+	srv       *grpc.Server
+	fs        *fs.FS
+	transfers chan struct{}
+	minfree   uint64
 	pb.UnimplementedImageIOServiceServer
 }
 
@@ -74,8 +91,43 @@ func NewImageIO(imgexp ImagePusherPuller, usrval UserValidator) *ImageIO {
 		klog.Fatalf("error setting up TLS: %s", err)
 	}
 
+	maxtransfers := DefaultMaxConcurrentTransfers
+	if val := os.Getenv("MAX_CONCURRENT_TRANSFERS"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			klog.Warningf(
+				"invalid MAX_CONCURRENT_TRANSFERS %q, using %d",
+				val, maxtransfers,
+			)
+		} else {
+			maxtransfers = parsed
+		}
+	}
+
+	minfree := DefaultMinFreeDiskBytes
+	if val := os.Getenv("MIN_FREE_DISK_BYTES"); val != "" {
+		parsed, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			klog.Warningf(
+				"invalid MIN_FREE_DISK_BYTES %q, using %d", val, minfree,
+			)
+		} else {
+			minfree = parsed
+		}
+	}
+
+	tio := &ImageIO{
+		bind:      ":8083",
+		imgexp:    imgexp,
+		usrval:    usrval,
+		fs:        fs.New(),
+		transfers: make(chan struct{}, maxtransfers),
+		minfree:   minfree,
+	}
+
 	opts := []grpc.ServerOption{
 		grpc.Creds(creds),
+		grpc.StreamInterceptor(tio.transferLimiter),
 		grpc.KeepaliveParams(
 			keepalive.ServerParameters{
 				MaxConnectionIdle:     time.Minute,
@@ -87,18 +139,33 @@ func NewImageIO(imgexp ImagePusherPuller, usrval UserValidator) *ImageIO {
 		),
 	}
 
-	tio := &ImageIO{
-		bind:   ":8083",
-		imgexp: imgexp,
-		usrval: usrval,
-		fs:     fs.New(),
-		srv:    grpc.NewServer(opts...),
-	}
+	tio.srv = grpc.NewServer(opts...)
 	pb.RegisterImageIOServiceServer(tio.srv, tio)
 	reflection.Register(tio.srv)
 	return tio
 }
 
+// transferLimiter is a stream interceptor capping the number of in-flight push and pull
+// streams. Streams over the cap are rejected right away with a ResourceExhausted status,
+// clients may retry once other transfers have finished.
+func (t *ImageIO) transferLimiter(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	select {
+	case t.transfers <- struct{}{}:
+		defer func() { <-t.transfers }()
+		return handler(srv, ss)
+	default:
+		return status.Error(
+			codes.ResourceExhausted,
+			"too many image transfers in flight, retry later",
+		)
+	}
+}
+
 // Pull handles an image pull through grpc. We receive a request informing what
 // is the Image to be pulled from (namespace and name) and also a kubernetes token
 // for authentication and authorization.
@@ -145,6 +212,11 @@ func (t *ImageIO) Push(stream pb.ImageIOService_PushServer) error {
 		return fmt.Errorf("error validating input: %w", err)
 	}
 
+	if err := t.ensureDiskSpace(); err != nil {
+		klog.Errorf("refusing image push: %s", err)
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
 	tmpfile, cleanup, err := t.fs.TempFile()
 	if err != nil {
 		klog.Errorf("error creating temp file: %s", err)
@@ -167,6 +239,24 @@ func (t *ImageIO) Push(stream pb.ImageIOService_PushServer) error {
 	return stream.SendAndClose(&pb.Packet{})
 }
 
+// ensureDiskSpace verifies the directory where pushes are assembled has at least the
+// configured amount of free disk space. Rejecting a push upfront beats failing halfway
+// through the transfer with an obscure disk full error.
+func (t *ImageIO) ensureDiskSpace() error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(t.fs.BaseTmpDir(), &stat); err != nil {
+		return fmt.Errorf("unable to stat temp dir: %w", err)
+	}
+
+	if free := stat.Bavail * uint64(stat.Bsize); free < t.minfree {
+		return fmt.Errorf(
+			"not enough free disk space to receive image (%d bytes available)",
+			free,
+		)
+	}
+	return nil
+}
+
 // authorizeRequest checks if all mandatory fields in a request are present.
 // It also does the validation if the token is capable of acessing Images in
 // provided namespace.
@@ -0,0 +1,76 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"math"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ricardomaraschini/tagger/infra/fs"
+)
+
+func Test_transferLimiter(t *testing.T) {
+	tio := &ImageIO{transfers: make(chan struct{}, 1)}
+
+	var called bool
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		called = true
+		return nil
+	}
+
+	if err := tio.transferLimiter(nil, nil, nil, handler); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !called {
+		t.Fatal("expected handler to be called")
+	}
+	if len(tio.transfers) != 0 {
+		t.Fatal("expected transfer slot to be released")
+	}
+
+	// occupy the only slot and make sure further streams are rejected with the
+	// appropriate grpc status.
+	tio.transfers <- struct{}{}
+	called = false
+	err := tio.transferLimiter(nil, nil, nil, handler)
+	if err == nil {
+		t.Fatal("expecting error, nil received")
+	}
+	if called {
+		t.Fatal("handler should not have been called")
+	}
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expecting ResourceExhausted, received %s", status.Code(err))
+	}
+}
+
+func Test_ensureDiskSpace(t *testing.T) {
+	tio := &ImageIO{fs: fs.New(fs.WithTmpDir(t.TempDir()))}
+
+	// with no floor configured any amount of free space is enough.
+	if err := tio.ensureDiskSpace(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// no filesystem can satisfy a floor this high, the check must fail.
+	tio.minfree = math.MaxUint64
+	if err := tio.ensureDiskSpace(); err == nil {
+		t.Error("expecting error, nil received")
+	}
+}
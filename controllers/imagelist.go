@@ -0,0 +1,156 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// ImageListSyncer abstraction exists to make testing easier. You most likely wanna see
+// ImageList struct under services/imagelist.go for a concrete implementation of this.
+type ImageListSyncer interface {
+	Sync(context.Context, *corev1.ConfigMap) error
+	Get(context.Context, string, string) (*corev1.ConfigMap, error)
+	AddEventHandler(cache.ResourceEventHandler)
+}
+
+// ImageList controller handles events related to declarative image list ConfigMaps. It
+// starts and receives events from the informer, calling appropriate functions on our
+// concrete services layer implementation.
+type ImageList struct {
+	queue  workqueue.RateLimitingInterface
+	lstsvc ImageListSyncer
+	appctx context.Context
+}
+
+// NewImageList returns a new controller for declarative image lists. This controller keeps
+// Image objects in sync with image references listed in a well known ConfigMap.
+func NewImageList(lstsvc ImageListSyncer) *ImageList {
+	ratelimit := workqueue.NewItemExponentialFailureRateLimiter(time.Second, time.Minute)
+	ctrl := &ImageList{
+		queue:  workqueue.NewRateLimitingQueue(ratelimit),
+		lstsvc: lstsvc,
+	}
+	lstsvc.AddEventHandler(ctrl.handlers())
+	return ctrl
+}
+
+// Name returns a name identifier for this controller.
+func (i *ImageList) Name() string {
+	return "image list"
+}
+
+// RequiresLeaderElection returns if this controller requires or not a leader lease to run.
+func (i *ImageList) RequiresLeaderElection() bool {
+	return true
+}
+
+// enqueueEvent generates a key using "namespace/name" for the event received and then enqueues
+// it to be processed.
+func (i *ImageList) enqueueEvent(o interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(o)
+	if err != nil {
+		klog.Errorf("fail to enqueue event: %v : %s", o, err)
+		return
+	}
+	i.queue.AddRateLimited(key)
+}
+
+// handlers return a event handler that will be called by the informer whenever an event occurs.
+// This handler basically enqueues everything in our work queue using enqueueEvent.
+func (i *ImageList) handlers() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(o interface{}) {
+			i.enqueueEvent(o)
+		},
+		UpdateFunc: func(o, n interface{}) {
+			i.enqueueEvent(o)
+		},
+		DeleteFunc: func(o interface{}) {
+			i.enqueueEvent(o)
+		},
+	}
+}
+
+// eventProcessor reads our events calling syncConfigMap for all of them.
+func (i *ImageList) eventProcessor(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		evt, end := i.queue.Get()
+		if end {
+			return
+		}
+
+		namespace, name, err := cache.SplitMetaNamespaceKey(evt.(string))
+		if err != nil {
+			klog.Errorf("invalid event received %s: %s", evt, err)
+			i.queue.Done(evt)
+			continue
+		}
+
+		klog.V(5).Infof("received event for config map: %s", evt)
+		if err := i.syncConfigMap(namespace, name); err != nil {
+			klog.Errorf("error processing config map %s: %v", evt, err)
+			i.queue.Done(evt)
+			i.queue.AddRateLimited(evt)
+			continue
+		}
+
+		klog.V(5).Infof("event for config map %s processed", evt)
+		i.queue.Done(evt)
+		i.queue.Forget(evt)
+	}
+}
+
+// syncConfigMap process an event for a config map.
+func (i *ImageList) syncConfigMap(namespace, name string) error {
+	ctx, cancel := context.WithTimeout(i.appctx, time.Minute)
+	defer cancel()
+
+	cm, err := i.lstsvc.Get(ctx, namespace, name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return i.lstsvc.Sync(ctx, cm)
+}
+
+// Start starts the controller's event loop.
+func (i *ImageList) Start(ctx context.Context) error {
+	// appctx is the 'keep going' context, if it is cancelled
+	// everything we might be doing should stop.
+	i.appctx = ctx
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go i.eventProcessor(&wg)
+
+	// wait until it is time to die.
+	<-i.appctx.Done()
+
+	i.queue.ShutDown()
+	wg.Wait()
+	return nil
+}
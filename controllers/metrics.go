@@ -16,6 +16,8 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -24,16 +26,36 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// InflightImportLister is implemented by entities capable of telling us what is being
+// imported right now. See the ImageImport controller for a concrete implementation.
+type InflightImportLister interface {
+	InflightImports() []InflightImport
+}
+
+// ReadinessChecker is implemented by entities capable of telling if tagger is able to
+// perform its core function. See the MirrorProbe controller for a concrete implementation.
+type ReadinessChecker interface {
+	Ready() bool
+}
+
 // Metric is our controller for metric requests. Spawns an http metric and exposes all metrics
-// registered on prometheus (see infra/metrics package to see what are we monitoring).
+// registered on prometheus (see infra/metrics package to see what are we monitoring). This
+// server also hosts a readiness endpoint and a debug endpoint through which operators can
+// inspect in-flight imports.
 type Metric struct {
-	bind string
+	bind   string
+	implis InflightImportLister
+	ready  ReadinessChecker
 }
 
-// NewMetric returns a new metric controller.
-func NewMetric() *Metric {
+// NewMetric returns a new metric controller. Provided InflightImportLister is used when
+// serving requests for the /debug/imports endpoint while the ReadinessChecker backs the
+// /readyz endpoint. A nil ReadinessChecker means always ready.
+func NewMetric(implis InflightImportLister, ready ReadinessChecker) *Metric {
 	return &Metric{
-		bind: ":8090",
+		bind:   ":8090",
+		implis: implis,
+		ready:  ready,
 	}
 }
 
@@ -47,11 +69,35 @@ func (m *Metric) RequiresLeaderElection() bool {
 	return false
 }
 
+// debugImports writes a JSON encoded list of all in-flight imports into the response.
+// This endpoint lives in the metrics port, which is not meant to be publicly exposed.
+func (m *Metric) debugImports(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(m.implis.InflightImports()); err != nil {
+		klog.Errorf("error encoding in-flight imports: %s", err)
+	}
+}
+
+// readyz reports if tagger is able to perform its core function. We report not-ready when
+// the mirror registry stops accepting our writes, see the MirrorProbe controller.
+func (m *Metric) readyz(w http.ResponseWriter, r *http.Request) {
+	if m.ready != nil && !m.ready.Ready() {
+		http.Error(w, "mirror registry not writable", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
 // Start puts the metrics http server online.
 func (m *Metric) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle("/", promhttp.Handler())
+	mux.HandleFunc("/readyz", m.readyz)
+	mux.HandleFunc("/debug/imports", m.debugImports)
+
 	server := &http.Server{
 		Addr:    m.bind,
-		Handler: promhttp.Handler(),
+		Handler: mux,
 	}
 
 	go func() {
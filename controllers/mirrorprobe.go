@@ -0,0 +1,113 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/ricardomaraschini/tagger/infra/metrics"
+)
+
+// MirrorWritableChecker is implemented by entities capable of verifying that the mirror
+// registry accepts writes. See services.SysContext for a concrete implementation.
+type MirrorWritableChecker interface {
+	MirrorWritable(ctx context.Context) error
+}
+
+// MirrorProbe periodically verifies the mirror registry accepts writes, keeping track of
+// the result so the readiness endpoint can report it. A failing probe is never fatal, the
+// state flips back to ready as soon as the mirror recovers.
+type MirrorProbe struct {
+	checker  MirrorWritableChecker
+	interval time.Duration
+	mtx      sync.Mutex
+	ready    bool
+}
+
+// NewMirrorProbe returns a new mirror probe controller. We start off as ready, flagging
+// not-ready only once a probe has actually failed.
+func NewMirrorProbe(checker MirrorWritableChecker) *MirrorProbe {
+	return &MirrorProbe{
+		checker:  checker,
+		interval: time.Minute,
+		ready:    true,
+	}
+}
+
+// Name returns a name identifier for this controller.
+func (m *MirrorProbe) Name() string {
+	return "mirror probe"
+}
+
+// RequiresLeaderElection returns if this controller requires or not a leader lease to run.
+func (m *MirrorProbe) RequiresLeaderElection() bool {
+	return false
+}
+
+// Ready returns if the last probe against the mirror registry succeeded.
+func (m *MirrorProbe) Ready() bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.ready
+}
+
+// probe runs a single verification against the mirror registry, recording its outcome.
+// Transitions between ready and not-ready are logged. The outcome is also exported
+// through the mirror reachability metrics so ops can alert on mirror health even when
+// no imports are running.
+func (m *MirrorProbe) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	err := m.checker.MirrorWritable(ctx)
+	metrics.MirrorLastCheckTimestamp.Set(float64(time.Now().Unix()))
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if err != nil {
+		if m.ready {
+			klog.Errorf("mirror registry not writable: %s", err)
+		}
+		m.ready = false
+		metrics.MirrorReachable.Set(0)
+		return
+	}
+	if !m.ready {
+		klog.Info("mirror registry writable again")
+	}
+	m.ready = true
+	metrics.MirrorReachable.Set(1)
+}
+
+// Start puts the mirror probe online, verifying the mirror registry immediately and then
+// at a fixed interval until the provided context is cancelled.
+func (m *MirrorProbe) Start(ctx context.Context) error {
+	m.probe(ctx)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			m.probe(ctx)
+		}
+	}
+}
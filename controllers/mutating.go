@@ -85,6 +85,23 @@ func (m *MutatingWebHook) RequiresLeaderElection() bool {
 	return false
 }
 
+// untaggedSourceWarnings returns one admission warning for each provided image source that
+// does not specify a tag or a digest. Those references rely on the cluster configured
+// default tag (":latest" unless overridden), we rather tell users about it than let them
+// be surprised during the import.
+func untaggedSourceWarnings(froms ...string) []string {
+	var warnings []string
+	for _, from := range froms {
+		if from == "" || imgv1b1.TaggedReference(from) {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"no tag or digest in %q, the configured default tag applies", from,
+		))
+	}
+	return warnings
+}
+
 // responseError writes in the provided ResponseWriter an AdmissionReview with response status set
 // to an error. If AdmissionReview contains an UID that is inserted into the reply as well.
 func (m *MutatingWebHook) responseError(
@@ -185,8 +202,9 @@ func (m *MutatingWebHook) imageimport(w http.ResponseWriter, r *http.Request) {
 			Kind:       "AdmissionReview",
 		},
 		Response: &admnv1.AdmissionResponse{
-			Allowed: true,
-			UID:     reviewReq.Request.UID,
+			Allowed:  true,
+			UID:      reviewReq.Request.UID,
+			Warnings: untaggedSourceWarnings(append(timp.Spec.Sources, timp.Spec.From)...),
 		},
 	}
 
@@ -242,8 +260,9 @@ func (m *MutatingWebHook) image(w http.ResponseWriter, r *http.Request) {
 			Kind:       "AdmissionReview",
 		},
 		Response: &admnv1.AdmissionResponse{
-			Allowed: true,
-			UID:     reviewReq.Request.UID,
+			Allowed:  true,
+			UID:      reviewReq.Request.UID,
+			Warnings: untaggedSourceWarnings(append(img.Spec.Sources, img.Spec.From)...),
 		},
 	}
 
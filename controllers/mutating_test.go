@@ -201,3 +201,47 @@ func Test_image(t *testing.T) {
 		})
 	}
 }
+
+func Test_untaggedSourceWarnings(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		froms []string
+		exp   int
+	}{
+		{
+			name:  "all sources tagged",
+			froms: []string{"centos:latest", "quay.io/repo/img:v1"},
+			exp:   0,
+		},
+		{
+			name:  "reference by digest",
+			froms: []string{"quay.io/repo/img@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"},
+			exp:   0,
+		},
+		{
+			name:  "untagged source",
+			froms: []string{"centos"},
+			exp:   1,
+		},
+		{
+			name:  "registry with port and no tag",
+			froms: []string{"registry.io:5000/repo/img"},
+			exp:   1,
+		},
+		{
+			name:  "empty sources are skipped",
+			froms: []string{"", "centos", "quay.io/repo/img"},
+			exp:   2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := untaggedSourceWarnings(tt.froms...)
+			if len(warnings) != tt.exp {
+				t.Errorf(
+					"expecting %d warnings, received %d: %v",
+					tt.exp, len(warnings), warnings,
+				)
+			}
+		})
+	}
+}
@@ -5,8 +5,11 @@ go 1.16
 require (
 	github.com/containers/image/v5 v5.17.0
 	github.com/containers/storage v1.37.0
+	github.com/docker/distribution v2.7.1+incompatible
 	github.com/google/uuid v1.3.0
 	github.com/hashicorp/go-multierror v1.1.1
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.2-0.20210819154149-5ad6f50d6283
 	github.com/prometheus/client_golang v1.11.0
 	github.com/spf13/cobra v1.2.1
 	github.com/vbauerster/mpb/v6 v6.0.4
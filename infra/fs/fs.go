@@ -45,6 +45,15 @@ func New(opts ...Option) *FS {
 	return f
 }
 
+// BaseTmpDir returns the base directory under which temporary files and directories are
+// created, the system default temp directory when none has been set.
+func (f *FS) BaseTmpDir() string {
+	if f.tmpdir == "" {
+		return os.TempDir()
+	}
+	return f.tmpdir
+}
+
 // TempDir creates and returns a temporary dir inside our base temp dir specified on FS.tmpdir.
 // Returns the directory path, a clean up function (delete dir) or an error.
 func (f *FS) TempDir() (string, func(), error) {
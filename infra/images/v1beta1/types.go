@@ -16,6 +16,7 @@ package v1beta1
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,6 +29,9 @@ var (
 	MaxImportAttempts = 10
 	// MaxImageHReferences tells us how many image references a Image can hold on its status.
 	MaxImageHReferences = 25
+	// MaxRecentFailures tells us how many permanently failed imports an Image keeps on its
+	// status for later inspection.
+	MaxRecentFailures = 10
 	// GroupVersion is a string that holds "group/version" for the resources of this package.
 	GroupVersion = fmt.Sprintf("%s/%s", SchemeGroupVersion.Group, SchemeGroupVersion.Version)
 	// ImageKind holds the kind we use when saving Images in the k8s API.
@@ -38,6 +42,10 @@ var (
 	// whenever the temporary ImageImport object has already been consumed and is not
 	// needed anymore.
 	ImageImportConsumedFlagAnnotation = "tagger.dev/consumed"
+	// ReconcileRequestAnnotation is an annotation users may touch on an Image to force
+	// an immediate reconcile of the object, its value is irrelevant, any change to it
+	// wakes up the controller.
+	ReconcileRequestAnnotation = "tagger.dev/reconcile-requested"
 	// ConditionTypeImported is a condition we report in ImageImport objects, presenting the
 	// current Import status back to the user.
 	ConditionTypeImported = "Imported"
@@ -70,9 +78,48 @@ func (t *Image) PrependFinishedImports(imps []ImageImport) {
 	}
 }
 
+// HoldFinishedImports records the most recent of the provided finished imports as the
+// Image pending reference instead of advancing the reference list, see
+// spec.requireApproval. An import pointing to the reference already active does not
+// generate a pending approval, it clears any previously held one instead (the source
+// moved back to what we already run).
+func (t *Image) HoldFinishedImports(imps []ImageImport) {
+	for i := len(imps) - 1; i >= 0; i-- {
+		if imps[i].Status.HashReference == nil {
+			continue
+		}
+
+		href := *imps[i].Status.HashReference
+		if href.ImageReference == t.CurrentReferenceForImage() {
+			t.Status.PendingReference = nil
+			return
+		}
+		t.Status.PendingReference = &href
+		return
+	}
+}
+
+// ApprovePendingReference flips the pending reference into the active one, advancing the
+// Image reference list. Calling it on an Image without a pending reference is a no-op.
+func (t *Image) ApprovePendingReference() {
+	if t.Status.PendingReference == nil {
+		return
+	}
+
+	t.PrependFinishedImport(
+		ImageImport{
+			Status: ImageImportStatus{
+				HashReference: t.Status.PendingReference,
+			},
+		},
+	)
+	t.Status.PendingReference = nil
+}
+
 // PrependFinishedImport prepends provided ImageImport into Image status hash references,
-// keeps MaxImageHReferences references. We do not prepend the provided ImageImport if the
-// most recent import in the Image points to the same image.
+// keeps MaxImageHReferences references or spec.maxReferences when set to a tighter limit.
+// We do not prepend the provided ImageImport if the most recent import in the Image
+// points to the same image.
 func (t *Image) PrependFinishedImport(imp ImageImport) {
 	if imp.Status.HashReference == nil {
 		return
@@ -91,22 +138,72 @@ func (t *Image) PrependFinishedImport(imp ImageImport) {
 		}
 	}
 
+	max := MaxImageHReferences
+	if t.Spec.MaxReferences > 0 && t.Spec.MaxReferences < max {
+		max = t.Spec.MaxReferences
+	}
+
 	all := append([]HashReference{href}, t.Status.HashReferences...)
-	if len(all) > MaxImageHReferences {
-		all = all[0:MaxImageHReferences]
+	if len(all) > max {
+		all = all[0:max]
 	}
 
 	t.Status.HashReferences = all
 }
 
+// PrependImportFailure prepends provided ImportFailure into Image status recent failures,
+// keeps at most MaxRecentFailures entries.
+func (t *Image) PrependImportFailure(fail ImportFailure) {
+	all := append([]ImportFailure{fail}, t.Status.RecentFailures...)
+	if len(all) > MaxRecentFailures {
+		all = all[0:MaxRecentFailures]
+	}
+	t.Status.RecentFailures = all
+}
+
 // Validate checks Image contain all mandatory fields.
 func (t *Image) Validate() error {
-	if t.Spec.From == "" {
-		return fmt.Errorf("empty spec.from")
+	if t.Spec.From == "" && len(t.Spec.Sources) == 0 {
+		return fmt.Errorf("empty spec.from and spec.sources")
+	}
+	if t.Spec.ImportTimeout != "" {
+		if _, err := time.ParseDuration(t.Spec.ImportTimeout); err != nil {
+			return fmt.Errorf("invalid spec.importTimeout: %w", err)
+		}
+	}
+	if t.Spec.MaxSizeBytes < 0 {
+		return fmt.Errorf("negative spec.maxSizeBytes")
+	}
+	if t.Spec.MaxReferences < 0 {
+		return fmt.Errorf("negative spec.maxReferences")
+	}
+	if t.Spec.TTLAfterLastImport != "" {
+		ttl, err := time.ParseDuration(t.Spec.TTLAfterLastImport)
+		if err != nil {
+			return fmt.Errorf("invalid spec.ttlAfterLastImport: %w", err)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("non positive spec.ttlAfterLastImport")
+		}
 	}
 	return nil
 }
 
+// TTLExceeded returns if the Image has outlived its spec.ttlAfterLastImport, i.e. its
+// newest reference is older than the configured TTL. Images without a TTL or without any
+// imported reference never expire.
+func (t *Image) TTLExceeded() bool {
+	if t.Spec.TTLAfterLastImport == "" || len(t.Status.HashReferences) == 0 {
+		return false
+	}
+
+	ttl, err := time.ParseDuration(t.Spec.TTLAfterLastImport)
+	if err != nil || ttl <= 0 {
+		return false
+	}
+	return time.Since(t.Status.HashReferences[0].ImportedAt.Time) > ttl
+}
+
 // FlagAsConsumed is used whenever we have already processed the data in an ImageImport object.
 // This Annotation does not indicate anything at the k8s scope and it is solely used inside this
 // operator. The value in the annotation is the current date and time encoded as time.ANSIC.
@@ -152,15 +249,43 @@ func (t *Image) CurrentReferenceForImage() string {
 }
 
 // ImageSpec represents the user intention with regards to importing remote images.
+// MirrorManifestType, when set, makes us convert the image manifest to the provided
+// media type when mirroring, empty means preserve whatever media type the source
+// image uses. Sources holds a list of remote locations to be attempted in order during
+// an import, the first one to succeed wins; From is sugar for a one-element Sources.
+// Platform, when set (an "os/arch" or "os/arch/variant" string), makes us record the
+// digest of the matching platform specific manifest instead of the manifest list digest.
+// MirrorArchitectures is a different beast: it does not change what gets recorded (the
+// canonical manifest list digest still is), it only restricts which architectures are
+// copied into the mirror, saving mirror space for clusters running a single arch.
+// MaxReferences bounds how many imported references this Image keeps on its status,
+// useful for high churn images; zero means the global MaxImageHReferences limit and the
+// most recent reference is never trimmed away.
 type ImageSpec struct {
-	From     string `json:"from"`
-	Mirror   bool   `json:"mirror"`
-	Insecure bool   `json:"insecure"`
+	From                string   `json:"from"`
+	Sources             []string `json:"sources,omitempty"`
+	Mirror              bool     `json:"mirror"`
+	Insecure            bool     `json:"insecure"`
+	MirrorManifestType  string   `json:"mirrorManifestType,omitempty"`
+	MirrorArchitectures []string `json:"mirrorArchitectures,omitempty"`
+	Platform            string   `json:"platform,omitempty"`
+	ImportTimeout       string   `json:"importTimeout,omitempty"`
+	MaxSizeBytes        int64    `json:"maxSizeBytes,omitempty"`
+	MaxReferences       int      `json:"maxReferences,omitempty"`
+	TTLAfterLastImport  string   `json:"ttlAfterLastImport,omitempty"`
+	RequireApproval     bool     `json:"requireApproval,omitempty"`
 }
 
-// ImageStatus is the current status for an Image.
+// ImageStatus is the current status for an Image. Consumers holds the names of the
+// Deployments in the namespace currently referencing this Image, it is maintained on a
+// best effort basis (eventually consistent) and capped in length, see the deployment
+// service for details. PendingReference holds an already resolved (and mirrored)
+// reference waiting for a human approval, see spec.requireApproval.
 type ImageStatus struct {
-	HashReferences []HashReference `json:"hashReferences,omitempty"`
+	HashReferences   []HashReference `json:"hashReferences,omitempty"`
+	RecentFailures   []ImportFailure `json:"recentFailures,omitempty"`
+	Consumers        []string        `json:"consumers,omitempty"`
+	PendingReference *HashReference  `json:"pendingReference,omitempty"`
 }
 
 // ImportAttempt holds data about an import cycle. Keeps track if it was successful, when it
@@ -171,11 +296,34 @@ type ImportAttempt struct {
 	Reason  string      `json:"reason,omitempty"`
 }
 
-// HashReference is an reference to an imported Image (by its sha).
+// ImportFailure holds data about an ImageImport that has exhausted all its attempts. These
+// are kept in the Image status so operators can review permanent failures even after the
+// ImageImport objects themselves are deleted.
+type ImportFailure struct {
+	Name   string      `json:"name"`
+	From   string      `json:"from"`
+	Reason string      `json:"reason,omitempty"`
+	When   metav1.Time `json:"when"`
+}
+
+// HashReference is an reference to an imported Image (by its sha). CreatedAt holds the
+// timestamp the image was built at, as reported by its config blob; it is only populated
+// when the operator is configured to fetch it. ResolvedTag holds, on a best effort basis,
+// the immutable tag the source floating tag pointed to at import time; it is only populated
+// when the operator is configured to cross reference tags. ImportedBy and ImporterVersion
+// record which operator replica (pod name) and binary version performed the import, useful
+// when correlating behavior changes with upgrades in multi replica setups. Labels holds a
+// subset of the image config labels captured at import time, the operator config selects
+// which keys (if any) get recorded.
 type HashReference struct {
-	From           string      `json:"from"`
-	ImportedAt     metav1.Time `json:"importedAt"`
-	ImageReference string      `json:"imageReference,omitempty"`
+	From            string            `json:"from"`
+	ImportedAt      metav1.Time       `json:"importedAt"`
+	CreatedAt       *metav1.Time      `json:"createdAt,omitempty"`
+	ResolvedTag     string            `json:"resolvedTag,omitempty"`
+	ImageReference  string            `json:"imageReference,omitempty"`
+	ImportedBy      string            `json:"importedBy,omitempty"`
+	ImporterVersion string            `json:"importerVersion,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -242,6 +390,14 @@ func (t *ImageImport) Validate() error {
 	if t.Spec.TargetImage == "" {
 		return fmt.Errorf("empty spec.targetImage")
 	}
+	if t.Spec.ImportTimeout != "" {
+		if _, err := time.ParseDuration(t.Spec.ImportTimeout); err != nil {
+			return fmt.Errorf("invalid spec.importTimeout: %w", err)
+		}
+	}
+	if t.Spec.MaxSizeBytes < 0 {
+		return fmt.Errorf("negative spec.maxSizeBytes")
+	}
 	return nil
 }
 
@@ -258,6 +414,10 @@ func (t *ImageImport) InheritValuesFrom(it *Image) {
 		t.Spec.From = it.Spec.From
 	}
 
+	if len(t.Spec.Sources) == 0 {
+		t.Spec.Sources = it.Spec.Sources
+	}
+
 	if t.Spec.Insecure == nil {
 		t.Spec.Insecure = pointer.Bool(it.Spec.Insecure)
 	}
@@ -265,6 +425,45 @@ func (t *ImageImport) InheritValuesFrom(it *Image) {
 	if t.Spec.Mirror == nil {
 		t.Spec.Mirror = pointer.Bool(it.Spec.Mirror)
 	}
+
+	if t.Spec.MirrorManifestType == "" {
+		t.Spec.MirrorManifestType = it.Spec.MirrorManifestType
+	}
+
+	if len(t.Spec.MirrorArchitectures) == 0 {
+		t.Spec.MirrorArchitectures = it.Spec.MirrorArchitectures
+	}
+
+	if t.Spec.Platform == "" {
+		t.Spec.Platform = it.Spec.Platform
+	}
+
+	if t.Spec.ImportTimeout == "" {
+		t.Spec.ImportTimeout = it.Spec.ImportTimeout
+	}
+
+	if t.Spec.MaxSizeBytes == 0 {
+		t.Spec.MaxSizeBytes = it.Spec.MaxSizeBytes
+	}
+}
+
+// ImportTimeoutDuration returns spec.importTimeout parsed as a time.Duration. Returns zero
+// when the property is not set, callers are expected to apply their own default.
+func (t *ImageImport) ImportTimeoutDuration() (time.Duration, error) {
+	if t.Spec.ImportTimeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(t.Spec.ImportTimeout)
+}
+
+// SourcesToImport returns the list of remote locations we should attempt to import from,
+// in order. When spec.sources is populated it takes precedence, otherwise spec.from is
+// treated as a one-element sources list.
+func (t *ImageImport) SourcesToImport() []string {
+	if len(t.Spec.Sources) > 0 {
+		return t.Spec.Sources
+	}
+	return []string{t.Spec.From}
 }
 
 // AlreadyImported checks if a given ImageImport has already been executed, we evaluate this by
@@ -284,6 +483,36 @@ func (t *ImageImport) FailedImportAttempts() int {
 	return count
 }
 
+// ConsecutiveManifestUnknownFailures returns how many of the most recent import attempts
+// failed because the source manifest is unknown to the registry, stopping at the first
+// attempt that succeeded or failed for a different reason. A growing streak here usually
+// means the upstream tag has been deleted and further retries are pointless.
+func (t *ImageImport) ConsecutiveManifestUnknownFailures() int {
+	count := 0
+	for i := len(t.Status.ImportAttempts) - 1; i >= 0; i-- {
+		att := t.Status.ImportAttempts[i]
+		if att.Succeed || !strings.Contains(att.Reason, "manifest unknown") {
+			break
+		}
+		count++
+	}
+	return count
+}
+
+// PermanentFailure returns an ImportFailure describing this ImageImport once all of its
+// import attempts have been exhausted. The reason is copied over from the last attempt.
+func (t *ImageImport) PermanentFailure() ImportFailure {
+	fail := ImportFailure{
+		Name: t.Name,
+		From: t.Spec.From,
+		When: metav1.NewTime(time.Now()),
+	}
+	if len(t.Status.ImportAttempts) > 0 {
+		fail.Reason = t.Status.ImportAttempts[len(t.Status.ImportAttempts)-1].Reason
+	}
+	return fail
+}
+
 // RegisterImportFailure updates the import attempts slice appending a new failed attempt with
 // the provided error. This function also sets ImageImport.Status.Condition field.
 func (t *ImageImport) RegisterImportFailure(err error) {
@@ -310,13 +539,22 @@ func (t *ImageImport) RegisterImportFailure(err error) {
 	failures := len(t.Status.ImportAttempts)
 	if failures >= MaxImportAttempts {
 		// here we have exhausted all import attempts, set it as Failed and return.
+		// there is no retry to wait for anymore.
 		t.Status.Condition = nextcond
+		t.Status.NextRetryTime = nil
 		return
 	}
 
 	// if we hit here then we still have some import attempts to be executed, set its
-	// condition to Progressing.
-	message = fmt.Sprintf("Import attempt %d/%d", failures, MaxImportAttempts)
+	// condition to Progressing and estimate when the next attempt takes place so
+	// users inspecting the object know what they are waiting for.
+	nextretry := metav1.NewTime(time.Now().Add(NextRetryDelay(failures)))
+	t.Status.NextRetryTime = &nextretry
+
+	message = fmt.Sprintf(
+		"Import attempt %d/%d, next retry at %s",
+		failures, MaxImportAttempts, nextretry.Format(time.ANSIC),
+	)
 	nextcond.Status = metav1.ConditionFalse
 	nextcond.Reason = ConditionReasonProgressing
 	nextcond.Message = message
@@ -327,6 +565,33 @@ func (t *ImageImport) RegisterImportFailure(err error) {
 	t.Status.Condition = nextcond
 }
 
+// TaggedReference returns if provided image path explicitly specifies a tag or a digest.
+// Paths without one rely on the cluster configured default tag during imports.
+func TaggedReference(imgpath string) bool {
+	if strings.Contains(imgpath, "@") {
+		return true
+	}
+	name := imgpath
+	if idx := strings.LastIndex(imgpath, "/"); idx >= 0 {
+		name = imgpath[idx+1:]
+	}
+	return strings.Contains(name, ":")
+}
+
+// NextRetryDelay returns for how long we are expected to wait before reattempting an import
+// that has already failed the provided number of times. This mirrors the exponential backoff
+// applied by the controller's work queue (base delay of one second, capped at one minute).
+func NextRetryDelay(failures int) time.Duration {
+	if failures < 1 {
+		failures = 1
+	}
+	delay := time.Second << (failures - 1)
+	if delay > time.Minute || delay <= 0 {
+		delay = time.Minute
+	}
+	return delay
+}
+
 // RegisterImportSuccess appends a new ImportAttempt to the status registering it worked as
 // expected. This function also sets ImageImport.Status.Condition field.
 func (t *ImageImport) RegisterImportSuccess() {
@@ -338,6 +603,7 @@ func (t *ImageImport) RegisterImportSuccess() {
 		},
 	)
 
+	t.Status.NextRetryTime = nil
 	t.Status.Condition = metav1.Condition{
 		Type:               ConditionTypeImported,
 		Status:             metav1.ConditionTrue,
@@ -351,17 +617,26 @@ func (t *ImageImport) RegisterImportSuccess() {
 // a remote location. Values not set in here are read from the TargetImage, e.g.  if no "mirror"
 // is set here but it is set in the targetImage we use it.
 type ImageImportSpec struct {
-	TargetImage string `json:"targetImage"`
-	From        string `json:"from"`
-	Mirror      *bool  `json:"mirror,omitempty"`
-	Insecure    *bool  `json:"insecure,omitempty"`
+	TargetImage         string   `json:"targetImage"`
+	From                string   `json:"from"`
+	Sources             []string `json:"sources,omitempty"`
+	Mirror              *bool    `json:"mirror,omitempty"`
+	Insecure            *bool    `json:"insecure,omitempty"`
+	MirrorManifestType  string   `json:"mirrorManifestType,omitempty"`
+	MirrorArchitectures []string `json:"mirrorArchitectures,omitempty"`
+	Platform            string   `json:"platform,omitempty"`
+	ImportTimeout       string   `json:"importTimeout,omitempty"`
+	MaxSizeBytes        int64    `json:"maxSizeBytes,omitempty"`
 }
 
-// ImageImportStatus holds the current status for an image tag import attempt.
+// ImageImportStatus holds the current status for an image tag import attempt. NextRetryTime
+// is a estimate of when the next import attempt is going to happen, it is only set while
+// there are still attempts to be executed.
 type ImageImportStatus struct {
 	Condition      metav1.Condition `json:"condition"`
 	ImportAttempts []ImportAttempt  `json:"importAttempts"`
 	HashReference  *HashReference   `json:"hashReference,omitempty"`
+	NextRetryTime  *metav1.Time     `json:"nextRetryTime,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
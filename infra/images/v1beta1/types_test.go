@@ -0,0 +1,229 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_PrependFinishedImportMaxReferences(t *testing.T) {
+	importFor := func(ref string) ImageImport {
+		return ImageImport{
+			Status: ImageImportStatus{
+				HashReference: &HashReference{
+					ImportedAt:     metav1.NewTime(time.Now()),
+					ImageReference: ref,
+				},
+			},
+		}
+	}
+
+	img := &Image{
+		Spec: ImageSpec{
+			From:          "quay.io/repo/myapp:latest",
+			MaxReferences: 2,
+		},
+	}
+
+	for i := 0; i < 5; i++ {
+		img.PrependFinishedImport(
+			importFor(fmt.Sprintf("quay.io/repo/myapp@sha256:%d", i)),
+		)
+		if len(img.Status.HashReferences) > 2 {
+			t.Fatalf(
+				"expecting at most 2 references, %d found",
+				len(img.Status.HashReferences),
+			)
+		}
+	}
+
+	// the oldest references were trimmed while the active generation, the last
+	// one prepended, is always preserved.
+	if ref := img.CurrentReferenceForImage(); ref != "quay.io/repo/myapp@sha256:4" {
+		t.Errorf("unexpected current reference %s", ref)
+	}
+
+	// without a per image limit the global cap applies.
+	img = &Image{Spec: ImageSpec{From: "quay.io/repo/myapp:latest"}}
+	for i := 0; i < 2*MaxImageHReferences; i++ {
+		img.PrependFinishedImport(
+			importFor(fmt.Sprintf("quay.io/repo/myapp@sha256:%d", i)),
+		)
+	}
+	if len(img.Status.HashReferences) != MaxImageHReferences {
+		t.Errorf(
+			"expecting %d references, %d found",
+			MaxImageHReferences, len(img.Status.HashReferences),
+		)
+	}
+}
+
+func Test_ImageValidateMaxReferences(t *testing.T) {
+	img := &Image{
+		Spec: ImageSpec{
+			From:          "quay.io/repo/myapp:latest",
+			MaxReferences: -1,
+		},
+	}
+	if err := img.Validate(); err == nil {
+		t.Error("expecting error validating negative maxReferences, nil received")
+	}
+
+	img.Spec.MaxReferences = 10
+	if err := img.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func Test_ConsecutiveManifestUnknownFailures(t *testing.T) {
+	attempt := func(succeed bool, reason string) ImportAttempt {
+		return ImportAttempt{
+			When:    metav1.NewTime(time.Now()),
+			Succeed: succeed,
+			Reason:  reason,
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		attempts []ImportAttempt
+		exp      int
+	}{
+		{
+			name: "no attempts",
+		},
+		{
+			name: "streak of manifest unknown failures",
+			attempts: []ImportAttempt{
+				attempt(false, "error: manifest unknown"),
+				attempt(false, "error: manifest unknown"),
+			},
+			exp: 2,
+		},
+		{
+			name: "streak broken by a different failure",
+			attempts: []ImportAttempt{
+				attempt(false, "error: manifest unknown"),
+				attempt(false, "connection refused"),
+				attempt(false, "error: manifest unknown"),
+			},
+			exp: 1,
+		},
+		{
+			name: "streak broken by a success",
+			attempts: []ImportAttempt{
+				attempt(false, "error: manifest unknown"),
+				attempt(true, ""),
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			imp := &ImageImport{
+				Status: ImageImportStatus{
+					ImportAttempts: tt.attempts,
+				},
+			}
+			if res := imp.ConsecutiveManifestUnknownFailures(); res != tt.exp {
+				t.Errorf("expecting %d, received %d", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_ImageTTLExceeded(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ttl  string
+		age  time.Duration
+		refs bool
+		exp  bool
+	}{
+		{
+			name: "no ttl configured",
+			age:  time.Hour,
+			refs: true,
+		},
+		{
+			name: "ttl configured but image never imported",
+			ttl:  "1h",
+		},
+		{
+			name: "reference younger than ttl",
+			ttl:  "1h",
+			age:  time.Minute,
+			refs: true,
+		},
+		{
+			name: "reference aged past ttl",
+			ttl:  "1h",
+			age:  2 * time.Hour,
+			refs: true,
+			exp:  true,
+		},
+		{
+			name: "bogus ttl never expires",
+			ttl:  "an hour",
+			age:  2 * time.Hour,
+			refs: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &Image{
+				Spec: ImageSpec{
+					From:               "quay.io/repo/myapp:latest",
+					TTLAfterLastImport: tt.ttl,
+				},
+			}
+			if tt.refs {
+				img.Status.HashReferences = []HashReference{
+					{
+						ImportedAt:     metav1.NewTime(time.Now().Add(-tt.age)),
+						ImageReference: "quay.io/repo/myapp@sha256:abc",
+					},
+				}
+			}
+
+			if res := img.TTLExceeded(); res != tt.exp {
+				t.Errorf("expecting %v, received %v", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_ImageValidateTTL(t *testing.T) {
+	img := &Image{
+		Spec: ImageSpec{
+			From:               "quay.io/repo/myapp:latest",
+			TTLAfterLastImport: "not a duration",
+		},
+	}
+	if err := img.Validate(); err == nil {
+		t.Error("expecting error validating bogus ttlAfterLastImport, nil received")
+	}
+
+	img.Spec.TTLAfterLastImport = "-1h"
+	if err := img.Validate(); err == nil {
+		t.Error("expecting error validating negative ttlAfterLastImport, nil received")
+	}
+
+	img.Spec.TTLAfterLastImport = "24h"
+	if err := img.Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
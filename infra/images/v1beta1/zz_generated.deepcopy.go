@@ -29,6 +29,17 @@ import (
 func (in *HashReference) DeepCopyInto(out *HashReference) {
 	*out = *in
 	in.ImportedAt.DeepCopyInto(&out.ImportedAt)
+	if in.CreatedAt != nil {
+		in, out := &in.CreatedAt, &out.CreatedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -47,7 +58,7 @@ func (in *Image) DeepCopyInto(out *Image) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -134,6 +145,11 @@ func (in *ImageImportList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageImportSpec) DeepCopyInto(out *ImageImportSpec) {
 	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Mirror != nil {
 		in, out := &in.Mirror, &out.Mirror
 		*out = new(bool)
@@ -144,6 +160,11 @@ func (in *ImageImportSpec) DeepCopyInto(out *ImageImportSpec) {
 		*out = new(bool)
 		**out = **in
 	}
+	if in.MirrorArchitectures != nil {
+		in, out := &in.MirrorArchitectures, &out.MirrorArchitectures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -168,6 +189,10 @@ func (in *ImageImportStatus) DeepCopyInto(out *ImageImportStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.NextRetryTime != nil {
+		in, out := &in.NextRetryTime, &out.NextRetryTime
+		*out = (*in).DeepCopy()
+	}
 	if in.HashReference != nil {
 		in, out := &in.HashReference, &out.HashReference
 		*out = new(HashReference)
@@ -222,6 +247,16 @@ func (in *ImageList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ImageSpec) DeepCopyInto(out *ImageSpec) {
 	*out = *in
+	if in.Sources != nil {
+		in, out := &in.Sources, &out.Sources
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MirrorArchitectures != nil {
+		in, out := &in.MirrorArchitectures, &out.MirrorArchitectures
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -245,6 +280,23 @@ func (in *ImageStatus) DeepCopyInto(out *ImageStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.RecentFailures != nil {
+		in, out := &in.RecentFailures, &out.RecentFailures
+		*out = make([]ImportFailure, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PendingReference != nil {
+		in, out := &in.PendingReference, &out.PendingReference
+		*out = new(HashReference)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -274,3 +326,20 @@ func (in *ImportAttempt) DeepCopy() *ImportAttempt {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImportFailure) DeepCopyInto(out *ImportFailure) {
+	*out = *in
+	in.When.DeepCopyInto(&out.When)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImportFailure.
+func (in *ImportFailure) DeepCopy() *ImportFailure {
+	if in == nil {
+		return nil
+	}
+	out := new(ImportFailure)
+	in.DeepCopyInto(out)
+	return out
+}
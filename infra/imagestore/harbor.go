@@ -0,0 +1,96 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RepositoryPreCreator is implemented by registry specific clients capable of creating the
+// destination repository (Harbor calls it a project) ahead of a push. Some registries refuse
+// pushes into repositories that do not exist yet, failing with a permission error.
+type RepositoryPreCreator interface {
+	EnsureRepository(ctx context.Context, name string) error
+}
+
+// HarborPreCreator creates Harbor projects through Harbor's v2 API. Implements the
+// RepositoryPreCreator interface.
+type HarborPreCreator struct {
+	address  string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewHarborPreCreator returns a client capable of creating projects in the Harbor instance
+// hosted at provided address. Insecure makes us tolerate invalid TLS certificates.
+func NewHarborPreCreator(address, username, password string, insecure bool) *HarborPreCreator {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if insecure {
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+
+	return &HarborPreCreator{
+		address:  address,
+		username: username,
+		password: password,
+		client:   client,
+	}
+}
+
+// EnsureRepository creates a project with the provided name, a project that already exists
+// is not an error. Projects are created as private.
+func (h *HarborPreCreator) EnsureRepository(ctx context.Context, name string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"project_name": name,
+		"public":       false,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling project: %w", err)
+	}
+
+	url := fmt.Sprintf("https://%s/api/v2.0/projects", h.address)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(h.username) > 0 {
+		req.SetBasicAuth(h.username, h.password)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error creating project: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// conflicts mean the project already exists, which is exactly what we want.
+	if resp.StatusCode == http.StatusConflict {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d creating project", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagestore
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHarborEnsureRepository(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		status int
+		err    string
+	}{
+		{
+			name:   "project created",
+			status: http.StatusCreated,
+		},
+		{
+			name:   "project already exists",
+			status: http.StatusConflict,
+		},
+		{
+			name:   "access denied",
+			status: http.StatusForbidden,
+			err:    "unexpected status",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewTLSServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodPost {
+						t.Errorf("unexpected method %s", r.Method)
+					}
+					if r.URL.Path != "/api/v2.0/projects" {
+						t.Errorf("unexpected path %s", r.URL.Path)
+					}
+					if user, pass, _ := r.BasicAuth(); user != "usr" || pass != "pwd" {
+						t.Errorf("unexpected credentials %s/%s", user, pass)
+					}
+
+					var project struct {
+						ProjectName string `json:"project_name"`
+					}
+					if err := json.NewDecoder(r.Body).Decode(&project); err != nil {
+						t.Errorf("error decoding body: %s", err)
+					}
+					if project.ProjectName != "myproject" {
+						t.Errorf("unexpected project %q", project.ProjectName)
+					}
+
+					w.WriteHeader(tt.status)
+				},
+			))
+			defer srv.Close()
+
+			addr := strings.TrimPrefix(srv.URL, "https://")
+			precreator := NewHarborPreCreator(addr, "usr", "pwd", true)
+
+			err := precreator.EnsureRepository(context.Background(), "myproject")
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting error %q, received %q", tt.err, err)
+				}
+				return
+			}
+			if len(tt.err) > 0 {
+				t.Error("expecting error, nil received")
+			}
+		})
+	}
+}
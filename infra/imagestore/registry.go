@@ -15,32 +15,132 @@
 package imagestore
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	imgcopy "github.com/containers/image/v5/copy"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	apiv2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
 
 	"github.com/ricardomaraschini/tagger/infra/fs"
 )
 
+// DefaultMaxParallelDownloads is the number of layers we copy concurrently per image when
+// no explicit value has been configured.
+const DefaultMaxParallelDownloads = 6
+
+// DefaultChildManifestRetries is the number of extra copy attempts Load gives to sources
+// whose manifest list references a child manifest the registry does not serve yet, when
+// retries have been requested through WithChildManifestRetries.
+const DefaultChildManifestRetries = 2
+
+// ChildManifestRetryDelay is how long Load waits before reattempting a copy that failed
+// due to a missing child manifest. A variable so tests can shorten the wait.
+var ChildManifestRetryDelay = 5 * time.Second
+
 // CleanFn is a function that must be called in order to clean up or free resources in use.
 type CleanFn func()
 
+// RegistryOption is a function that tweaks the behavior of a Registry instance.
+type RegistryOption func(*Registry)
+
+// WithMaxParallelDownloads sets the maximum number of layers copied concurrently when
+// loading images into the registry. Zero means DefaultMaxParallelDownloads.
+func WithMaxParallelDownloads(max uint) RegistryOption {
+	return func(r *Registry) {
+		if max == 0 {
+			return
+		}
+		r.maxParallelDownloads = max
+	}
+}
+
+// WithRepositoryPreCreator makes Load create the destination repository through the provided
+// RepositoryPreCreator before pushing. Meant for registries that refuse pushes into
+// repositories that do not exist yet (e.g. Harbor projects).
+func WithRepositoryPreCreator(precreator RepositoryPreCreator) RegistryOption {
+	return func(r *Registry) {
+		r.precreator = precreator
+	}
+}
+
+// LoadOption is a function that tweaks the behavior of a Load call.
+type LoadOption func(*loadOptions)
+
+// loadOptions gathers all tunable knobs honored by Load.
+type loadOptions struct {
+	forceManifestType string
+	skipIfPresent     bool
+	architectures     []string
+	childRetries      int
+}
+
+// WithForcedManifestType makes Load convert the image manifest to the provided media type
+// during the copy. An empty media type preserves whatever type the source image uses.
+func WithForcedManifestType(mtype string) LoadOption {
+	return func(o *loadOptions) {
+		o.forceManifestType = mtype
+	}
+}
+
+// WithMirrorArchitectures makes Load copy only the manifest list instances built for the
+// provided architectures. This is a space saver for clusters running a single arch, it does
+// not affect digest resolution (importers still record the canonical list digest), only
+// what ends up stored in the mirror. Single image sources are copied unrestricted as there
+// is no list to filter.
+func WithMirrorArchitectures(archs []string) LoadOption {
+	return func(o *loadOptions) {
+		o.architectures = archs
+	}
+}
+
+// WithChildManifestRetries makes Load reattempt the copy up to the provided number of
+// extra times when it fails because the source manifest list points to a child manifest
+// the registry does not serve. Freshly pushed multi arch images may have their list
+// visible before all per architecture manifests are (registry eventual consistency), a
+// short wait sorts those out; a genuinely broken list keeps failing and the last error
+// is returned once attempts are exhausted. Failures of any other nature are never
+// retried.
+func WithChildManifestRetries(retries int) LoadOption {
+	return func(o *loadOptions) {
+		o.childRetries = retries
+	}
+}
+
+// WithSkipIfPresent makes Load first verify if the mirror already hosts the source digest
+// under the destination repository, skipping the copy entirely on a hit. This check only
+// makes sense when no manifest conversion is in place (conversions change the digest
+// during the copy) so it is ignored when a manifest type is being forced.
+func WithSkipIfPresent() LoadOption {
+	return func(o *loadOptions) {
+		o.skipIfPresent = true
+	}
+}
+
 // Registry wraps calls for iteracting with our backend registry. It provides an implementation
 // capable of pushing to and pulling from an image registry. To push an image towards the
 // registry one needs to call Load, to push it to a local tar file a Save call should be made,
 // this strange naming is an attempt to make it similar to the 'docker save/load' commands.
 type Registry struct {
-	fs         *fs.FS
-	regaddr    string
-	repository string
-	polctx     *signature.PolicyContext
-	regctx     *types.SystemContext
+	fs                   *fs.FS
+	regaddr              string
+	repository           string
+	polctx               *signature.PolicyContext
+	regctx               *types.SystemContext
+	maxParallelDownloads uint
+	precreator           RepositoryPreCreator
 }
 
 // NewRegistry creates an entity capable of load objects to or save objects from a backend
@@ -53,27 +153,47 @@ func NewRegistry(
 	repository string,
 	sysctx *types.SystemContext,
 	polctx *signature.PolicyContext,
+	opts ...RegistryOption,
 ) *Registry {
-	return &Registry{
-		fs:         fs.New(),
-		regaddr:    regaddr,
-		polctx:     polctx,
-		regctx:     sysctx,
-		repository: repository,
+	reg := &Registry{
+		fs:                   fs.New(),
+		regaddr:              regaddr,
+		polctx:               polctx,
+		regctx:               sysctx,
+		repository:           repository,
+		maxParallelDownloads: DefaultMaxParallelDownloads,
+	}
+	for _, opt := range opts {
+		opt(reg)
 	}
+	return reg
 }
 
 // Load pushes an image reference into the backend registry. Uses srcctx (types.SystemContext)
 // when reading image from srcref, so when copying from one remote registry into our mirror
-// registry srcctx must contain all needed authentication information. Images may be stored in
-// mirror.registry.io/namespace/name or mirror.registry.io/repository/namespace-name.
+// registry srcctx must contain all needed authentication information. The mirror write always
+// happens with the Registry's own context (built from the mirror config), never with srcctx:
+// source and destination credentials are kept apart so registries issuing narrowly scoped
+// tokens (pull-only on the source, push on the mirror) work out of the box. Images may be
+// stored in mirror.registry.io/namespace/name or mirror.registry.io/repository/namespace-name.
+//
+// The copy preserves the image config blob verbatim, i.e. build history and creation
+// timestamps read from the mirror match the source, keeping provenance auditable on both
+// ends. The only exception is when a manifest conversion is requested (see
+// WithForcedManifestType), converting between manifest formats requires rewriting the
+// config so byte level preservation is impossible there.
 func (i *Registry) Load(
 	ctx context.Context,
 	srcref types.ImageReference,
 	srcctx *types.SystemContext,
 	ns string,
 	name string,
+	opts ...LoadOption,
 ) (types.ImageReference, error) {
+	var lo loadOptions
+	for _, opt := range opts {
+		opt(&lo)
+	}
 
 	tostr := fmt.Sprintf("docker://%s/%s/%s", i.regaddr, ns, name)
 	if len(i.repository) > 0 {
@@ -85,13 +205,44 @@ func (i *Registry) Load(
 		return nil, fmt.Errorf("invalid destination reference: %w", err)
 	}
 
-	manblob, err := imgcopy.Image(
-		ctx, i.polctx, toref, srcref, &imgcopy.Options{
-			ImageListSelection: imgcopy.CopyAllImages,
-			SourceCtx:          srcctx,
-			DestinationCtx:     i.regctx,
-		},
-	)
+	if i.precreator != nil {
+		project := ns
+		if len(i.repository) > 0 {
+			project = i.repository
+		}
+		if err := i.precreator.EnsureRepository(ctx, project); err != nil {
+			return nil, fmt.Errorf("unable to pre create repository: %w", err)
+		}
+	}
+
+	if lo.skipIfPresent && lo.forceManifestType == "" {
+		if ref, ok := i.alreadyPresent(ctx, srcref, toref); ok {
+			return ref, nil
+		}
+	}
+
+	copyopts := &imgcopy.Options{
+		ImageListSelection:    imgcopy.CopyAllImages,
+		SourceCtx:             srcctx,
+		DestinationCtx:        i.regctx,
+		ForceManifestMIMEType: lo.forceManifestType,
+		MaxParallelDownloads:  i.maxParallelDownloads,
+	}
+
+	if len(lo.architectures) > 0 {
+		instances, err := i.instancesForArchitectures(ctx, srcref, srcctx, lo.architectures)
+		if err != nil {
+			return nil, fmt.Errorf("unable to filter architectures: %w", err)
+		}
+		if instances != nil {
+			copyopts.ImageListSelection = imgcopy.CopySpecificImages
+			copyopts.Instances = instances
+		}
+	}
+
+	manblob, err := copyWithRetries(ctx, lo.childRetries, func() ([]byte, error) {
+		return imgcopy.Image(ctx, i.polctx, toref, srcref, copyopts)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("unable to load image: %w", err)
 	}
@@ -105,6 +256,194 @@ func (i *Registry) Load(
 	return alltransports.ParseImageName(refstr)
 }
 
+// copyWithRetries runs the provided copy function, reattempting it up to the provided
+// number of extra times when it fails due to a missing child manifest. Attempts are
+// spaced by ChildManifestRetryDelay, aborting early if the context is cancelled.
+func copyWithRetries(
+	ctx context.Context, retries int, copyfn func() ([]byte, error),
+) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		manblob, err := copyfn()
+		if err == nil {
+			return manblob, nil
+		}
+		if attempt >= retries || !isMissingChildManifest(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ChildManifestRetryDelay):
+		}
+	}
+}
+
+// isMissingChildManifest tells whether the provided copy error indicates the registry
+// does not (yet) serve a manifest referenced by the source. The docker transport
+// surfaces these as distribution api errors carrying the MANIFEST_UNKNOWN code, we fall
+// back to inspecting the error message for transports that flatten the error chain.
+func isMissingChildManifest(err error) bool {
+	var ec errcode.Error
+	if errors.As(err, &ec) {
+		return ec.Code == apiv2.ErrorCodeManifestUnknown
+	}
+
+	var ecs errcode.Errors
+	if errors.As(err, &ecs) {
+		for _, inner := range ecs {
+			if ie, ok := inner.(errcode.Error); ok {
+				if ie.Code == apiv2.ErrorCodeManifestUnknown {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return strings.Contains(err.Error(), "manifest unknown")
+}
+
+// instancesForArchitectures fetches the source manifest and, when it is a manifest list,
+// returns the digests of the instances built for the provided architectures. A nil slice
+// with no error means the source is a single image manifest and no filtering applies.
+func (i *Registry) instancesForArchitectures(
+	ctx context.Context,
+	srcref types.ImageReference,
+	srcctx *types.SystemContext,
+	archs []string,
+) ([]digest.Digest, error) {
+	img, err := srcref.NewImage(ctx, srcctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create image closer: %w", err)
+	}
+	defer img.Close()
+
+	manblob, mtype, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch image manifest: %w", err)
+	}
+	return selectInstancesByArchitecture(manblob, mtype, archs)
+}
+
+// selectInstancesByArchitecture parses the provided manifest blob and returns the digests
+// of the manifest list instances whose platform architecture matches one of the provided
+// architectures. Single image manifests yield a nil slice (nothing to filter), a manifest
+// list from which no instance matches is an error, mirroring nothing at all is certainly
+// not what the user meant. Docker manifest lists and OCI indexes share the "manifests"
+// array layout so a single decode covers both.
+func selectInstancesByArchitecture(
+	manblob []byte, mtype string, archs []string,
+) ([]digest.Digest, error) {
+	if !manifest.MIMETypeIsMultiImage(mtype) {
+		return nil, nil
+	}
+
+	var list struct {
+		Manifests []struct {
+			Digest   digest.Digest `json:"digest"`
+			Platform *struct {
+				Architecture string `json:"architecture"`
+			} `json:"platform"`
+		} `json:"manifests"`
+	}
+	if err := json.Unmarshal(manblob, &list); err != nil {
+		return nil, fmt.Errorf("unable to parse manifest list: %w", err)
+	}
+
+	wanted := map[string]bool{}
+	for _, arch := range archs {
+		wanted[arch] = true
+	}
+
+	var instances []digest.Digest
+	for _, inst := range list.Manifests {
+		if inst.Platform == nil || !wanted[inst.Platform.Architecture] {
+			continue
+		}
+		instances = append(instances, inst.Digest)
+	}
+
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no manifest list instance matches architectures %v", archs)
+	}
+	return instances, nil
+}
+
+// alreadyPresent checks if the digest pointed by srcref is already hosted in the mirror
+// under toref's repository, in which case there is nothing to copy. Returns the digest
+// based destination reference on a hit. Any error during the check is deliberately eaten,
+// we rather run a pointless copy than fail the whole load.
+func (i *Registry) alreadyPresent(
+	ctx context.Context, srcref types.ImageReference, toref types.ImageReference,
+) (types.ImageReference, bool) {
+	srcnamed := srcref.DockerReference()
+	if srcnamed == nil {
+		return nil, false
+	}
+
+	canonical, ok := srcnamed.(reference.Canonical)
+	if !ok {
+		return nil, false
+	}
+
+	refstr := fmt.Sprintf(
+		"docker://%s@%s", toref.DockerReference().Name(), canonical.Digest(),
+	)
+	destref, err := alltransports.ParseImageName(refstr)
+	if err != nil {
+		return nil, false
+	}
+
+	img, err := destref.NewImage(ctx, i.regctx)
+	if err != nil {
+		return nil, false
+	}
+	defer img.Close()
+
+	if _, _, err := img.Manifest(ctx); err != nil {
+		return nil, false
+	}
+	return destref, true
+}
+
+// Writable verifies the backend registry accepts pushes by uploading a tiny blob into a
+// throwaway repository. The blob is left unreferenced by any manifest so the registry's
+// garbage collection can dispose of it at will.
+func (i *Registry) Writable(ctx context.Context) error {
+	refstr := fmt.Sprintf("docker://%s/tagger-probe/readiness:latest", i.regaddr)
+	if len(i.repository) > 0 {
+		refstr = fmt.Sprintf(
+			"docker://%s/%s/tagger-probe-readiness:latest", i.regaddr, i.repository,
+		)
+	}
+
+	ref, err := alltransports.ParseImageName(refstr)
+	if err != nil {
+		return fmt.Errorf("invalid probe reference: %w", err)
+	}
+
+	dst, err := ref.NewImageDestination(ctx, i.regctx)
+	if err != nil {
+		return fmt.Errorf("unable to access mirror registry: %w", err)
+	}
+	defer dst.Close()
+
+	content := []byte("tagger mirror registry write probe")
+	if _, err := dst.PutBlob(
+		ctx,
+		bytes.NewReader(content),
+		types.BlobInfo{
+			Digest: digest.FromBytes(content),
+			Size:   int64(len(content)),
+		},
+		none.NoCache,
+		false,
+	); err != nil {
+		return fmt.Errorf("unable to push to mirror registry: %w", err)
+	}
+	return nil
+}
+
 // Save pulls an image from our mirror registry, stores it in a temporary
 // tar file on disk.  Returns an ImageReference pointing to the local tar
 // file and a function the caller needs to call in order to clean up after
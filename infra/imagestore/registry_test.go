@@ -0,0 +1,594 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagestore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/distribution/registry/api/errcode"
+	apiv2 "github.com/docker/distribution/registry/api/v2"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newOCILayout builds a minimal single-image oci layout inside a temporary directory,
+// returning an image reference pointing to it and a cleanup function. The image has one
+// uncompressed tar layer containing a single file.
+func newOCILayout(t *testing.T) (types.ImageReference, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "tagger-oci-layout-")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %s", err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	blobdir := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobdir, 0755); err != nil {
+		cleanup()
+		t.Fatalf("error creating blobs dir: %s", err)
+	}
+
+	writeBlob := func(content []byte) digest.Digest {
+		dgst := digest.FromBytes(content)
+		fpath := filepath.Join(blobdir, dgst.Encoded())
+		if err := ioutil.WriteFile(fpath, content, 0644); err != nil {
+			cleanup()
+			t.Fatalf("error writing blob: %s", err)
+		}
+		return dgst
+	}
+
+	var layer bytes.Buffer
+	tw := tar.NewWriter(&layer)
+	content := []byte("hello from tagger tests")
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "hello.txt",
+		Mode: 0644,
+		Size: int64(len(content)),
+	}); err != nil {
+		cleanup()
+		t.Fatalf("error writing tar header: %s", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		cleanup()
+		t.Fatalf("error writing tar content: %s", err)
+	}
+	if err := tw.Close(); err != nil {
+		cleanup()
+		t.Fatalf("error closing tar: %s", err)
+	}
+	layerdgst := writeBlob(layer.Bytes())
+
+	config := map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"created":      "2020-01-02T03:04:05Z",
+		"config":       map[string]interface{}{},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{layerdgst.String()},
+		},
+		"history": []map[string]interface{}{
+			{
+				"created":    "2020-01-02T03:04:05Z",
+				"created_by": "/bin/sh -c #(nop) ADD hello.txt",
+			},
+		},
+	}
+	cfgblob, err := json.Marshal(config)
+	if err != nil {
+		cleanup()
+		t.Fatalf("error marshaling config: %s", err)
+	}
+	cfgdgst := writeBlob(cfgblob)
+
+	man := map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     imgspecv1.MediaTypeImageManifest,
+		"config": map[string]interface{}{
+			"mediaType": imgspecv1.MediaTypeImageConfig,
+			"digest":    cfgdgst.String(),
+			"size":      len(cfgblob),
+		},
+		"layers": []map[string]interface{}{
+			{
+				"mediaType": imgspecv1.MediaTypeImageLayer,
+				"digest":    layerdgst.String(),
+				"size":      layer.Len(),
+			},
+		},
+	}
+	manblob, err := json.Marshal(man)
+	if err != nil {
+		cleanup()
+		t.Fatalf("error marshaling manifest: %s", err)
+	}
+	mandgst := writeBlob(manblob)
+
+	index := map[string]interface{}{
+		"schemaVersion": 2,
+		"manifests": []map[string]interface{}{
+			{
+				"mediaType": imgspecv1.MediaTypeImageManifest,
+				"digest":    mandgst.String(),
+				"size":      len(manblob),
+				"annotations": map[string]string{
+					imgspecv1.AnnotationRefName: "latest",
+				},
+			},
+		},
+	}
+	idxblob, err := json.Marshal(index)
+	if err != nil {
+		cleanup()
+		t.Fatalf("error marshaling index: %s", err)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, "index.json"), idxblob, 0644,
+	); err != nil {
+		cleanup()
+		t.Fatalf("error writing index: %s", err)
+	}
+	if err := ioutil.WriteFile(
+		filepath.Join(dir, "oci-layout"),
+		[]byte(`{"imageLayoutVersion": "1.0.0"}`),
+		0644,
+	); err != nil {
+		cleanup()
+		t.Fatalf("error writing oci-layout: %s", err)
+	}
+
+	ref, err := alltransports.ParseImageName(fmt.Sprintf("oci:%s:latest", dir))
+	if err != nil {
+		cleanup()
+		t.Fatalf("error parsing oci reference: %s", err)
+	}
+	return ref, cleanup
+}
+
+func TestLoadAndSave(t *testing.T) {
+	regaddr, regcleanup := NewTestRegistry(t)
+	defer regcleanup()
+
+	srcref, srccleanup := newOCILayout(t)
+	defer srccleanup()
+
+	pol := &signature.Policy{
+		Default: signature.PolicyRequirements{
+			signature.NewPRInsecureAcceptAnything(),
+		},
+	}
+	polctx, err := signature.NewPolicyContext(pol)
+	if err != nil {
+		t.Fatalf("error creating policy context: %s", err)
+	}
+
+	sysctx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	ctx := context.Background()
+	istore := NewRegistry(regaddr, "", sysctx, polctx)
+	loadref, err := istore.Load(ctx, srcref, nil, "ns", "img")
+	if err != nil {
+		t.Fatalf("unexpected error loading image: %s", err)
+	}
+
+	expprefix := fmt.Sprintf("%s/ns/img@sha256:", regaddr)
+	if !strings.HasPrefix(loadref.DockerReference().String(), expprefix) {
+		t.Errorf(
+			"loaded reference %q does not start with %q",
+			loadref.DockerReference().String(), expprefix,
+		)
+	}
+
+	saveref, cleanup, err := istore.Save(ctx, loadref)
+	if err != nil {
+		t.Fatalf("unexpected error saving image: %s", err)
+	}
+	defer cleanup()
+
+	fpath := saveref.StringWithinTransport()
+	fi, err := os.Stat(fpath)
+	if err != nil {
+		t.Fatalf("error inspecting saved tar file: %s", err)
+	}
+	if fi.Size() == 0 {
+		t.Errorf("saved tar file %s is empty", fpath)
+	}
+}
+
+func TestLoadWithRepository(t *testing.T) {
+	regaddr, regcleanup := NewTestRegistry(t)
+	defer regcleanup()
+
+	srcref, srccleanup := newOCILayout(t)
+	defer srccleanup()
+
+	pol := &signature.Policy{
+		Default: signature.PolicyRequirements{
+			signature.NewPRInsecureAcceptAnything(),
+		},
+	}
+	polctx, err := signature.NewPolicyContext(pol)
+	if err != nil {
+		t.Fatalf("error creating policy context: %s", err)
+	}
+
+	sysctx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	istore := NewRegistry(regaddr, "repo", sysctx, polctx)
+	loadref, err := istore.Load(context.Background(), srcref, nil, "ns", "img")
+	if err != nil {
+		t.Fatalf("unexpected error loading image: %s", err)
+	}
+
+	expprefix := fmt.Sprintf("%s/repo/ns-img@sha256:", regaddr)
+	if !strings.HasPrefix(loadref.DockerReference().String(), expprefix) {
+		t.Errorf(
+			"loaded reference %q does not start with %q",
+			loadref.DockerReference().String(), expprefix,
+		)
+	}
+}
+
+func TestLoadSkipIfPresent(t *testing.T) {
+	regaddr, regcleanup := NewTestRegistry(t)
+	defer regcleanup()
+
+	srcref, srccleanup := newOCILayout(t)
+	defer srccleanup()
+
+	pol := &signature.Policy{
+		Default: signature.PolicyRequirements{
+			signature.NewPRInsecureAcceptAnything(),
+		},
+	}
+	polctx, err := signature.NewPolicyContext(pol)
+	if err != nil {
+		t.Fatalf("error creating policy context: %s", err)
+	}
+
+	sysctx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	ctx := context.Background()
+	istore := NewRegistry(regaddr, "", sysctx, polctx)
+	loadref, err := istore.Load(ctx, srcref, nil, "ns", "img")
+	if err != nil {
+		t.Fatalf("unexpected error loading image: %s", err)
+	}
+
+	// points to the already mirrored digest but in a registry that does not
+	// exist, if the copy is skipped the source is never contacted.
+	slices := strings.SplitN(loadref.DockerReference().String(), "@", 2)
+	bogusstr := fmt.Sprintf("docker://registry.does.not.exist/repo/img@%s", slices[1])
+	bogusref, err := alltransports.ParseImageName(bogusstr)
+	if err != nil {
+		t.Fatalf("error parsing bogus reference: %s", err)
+	}
+
+	skipref, err := istore.Load(ctx, bogusref, nil, "ns", "img", WithSkipIfPresent())
+	if err != nil {
+		t.Fatalf("unexpected error loading already present image: %s", err)
+	}
+	if skipref.DockerReference().String() != loadref.DockerReference().String() {
+		t.Errorf(
+			"expected reference %q, received %q",
+			loadref.DockerReference().String(),
+			skipref.DockerReference().String(),
+		)
+	}
+
+	// the digest is not present under a different repository so the copy must
+	// be attempted, failing to reach the bogus source registry.
+	if _, err := istore.Load(
+		ctx, bogusref, nil, "otherns", "img", WithSkipIfPresent(),
+	); err == nil {
+		t.Error("expecting error loading from bogus source, nil received")
+	}
+}
+
+func TestWritable(t *testing.T) {
+	regaddr, regcleanup := NewTestRegistry(t)
+
+	sysctx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	istore := NewRegistry(regaddr, "", sysctx, nil)
+	if err := istore.Writable(context.Background()); err != nil {
+		t.Errorf("unexpected error probing test registry: %s", err)
+	}
+
+	// with the registry offline the probe must fail.
+	regcleanup()
+	if err := istore.Writable(context.Background()); err == nil {
+		t.Error("expecting error probing offline registry, nil received")
+	}
+}
+
+func Test_selectInstancesByArchitecture(t *testing.T) {
+	listblob := []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.list.v2+json",
+		"manifests": [
+			{
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"size": 100,
+				"digest": "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"platform": {"architecture": "amd64", "os": "linux"}
+			},
+			{
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"size": 100,
+				"digest": "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"platform": {"architecture": "arm64", "os": "linux"}
+			},
+			{
+				"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+				"size": 100,
+				"digest": "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+				"platform": {"architecture": "ppc64le", "os": "linux"}
+			}
+		]
+	}`)
+	listtype := "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	singleblob := []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		"config": {
+			"mediaType": "application/vnd.docker.container.image.v1+json",
+			"size": 100,
+			"digest": "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+		},
+		"layers": []
+	}`)
+	singletype := "application/vnd.docker.distribution.manifest.v2+json"
+
+	for _, tt := range []struct {
+		name    string
+		manblob []byte
+		mtype   string
+		archs   []string
+		expdgst []string
+		err     string
+	}{
+		{
+			name:    "single image manifest is not filtered",
+			manblob: singleblob,
+			mtype:   singletype,
+			archs:   []string{"amd64"},
+		},
+		{
+			name:    "single architecture selected",
+			manblob: listblob,
+			mtype:   listtype,
+			archs:   []string{"arm64"},
+			expdgst: []string{
+				"sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			},
+		},
+		{
+			name:    "multiple architectures selected",
+			manblob: listblob,
+			mtype:   listtype,
+			archs:   []string{"amd64", "ppc64le"},
+			expdgst: []string{
+				"sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+			},
+		},
+		{
+			name:    "no instance matches",
+			manblob: listblob,
+			mtype:   listtype,
+			archs:   []string{"s390x"},
+			err:     "no manifest list instance matches",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			instances, err := selectInstancesByArchitecture(
+				tt.manblob, tt.mtype, tt.archs,
+			)
+			if err != nil {
+				if tt.err == "" {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting %q in error %q", tt.err, err)
+				}
+				return
+			}
+			if tt.err != "" {
+				t.Fatalf("expecting error %q, nil received", tt.err)
+			}
+			if len(instances) != len(tt.expdgst) {
+				t.Fatalf(
+					"expecting %d instances, %d found",
+					len(tt.expdgst), len(instances),
+				)
+			}
+			for i, dgst := range tt.expdgst {
+				if instances[i].String() != dgst {
+					t.Errorf(
+						"expecting digest %s, found %s",
+						dgst, instances[i],
+					)
+				}
+			}
+		})
+	}
+}
+
+func Test_copyWithRetries(t *testing.T) {
+	olddelay := ChildManifestRetryDelay
+	ChildManifestRetryDelay = time.Millisecond
+	defer func() { ChildManifestRetryDelay = olddelay }()
+
+	missingchild := errcode.Errors{
+		apiv2.ErrorCodeManifestUnknown.WithMessage("manifest unknown"),
+	}
+
+	// simulates a child manifest that only becomes available on the second
+	// attempt, the copy must succeed without surfacing the transient error.
+	var attempts int
+	manblob, err := copyWithRetries(
+		context.Background(), DefaultChildManifestRetries,
+		func() ([]byte, error) {
+			attempts++
+			if attempts == 1 {
+				return nil, missingchild
+			}
+			return []byte("manifest"), nil
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(manblob) != "manifest" {
+		t.Errorf("unexpected manifest blob %q", manblob)
+	}
+	if attempts != 2 {
+		t.Errorf("expecting 2 attempts, %d executed", attempts)
+	}
+
+	// a genuinely broken list never resolves, the error must be returned once
+	// all attempts are exhausted.
+	attempts = 0
+	if _, err := copyWithRetries(
+		context.Background(), DefaultChildManifestRetries,
+		func() ([]byte, error) {
+			attempts++
+			return nil, missingchild
+		},
+	); err == nil {
+		t.Error("expecting error, nil received")
+	}
+	if attempts != DefaultChildManifestRetries+1 {
+		t.Errorf(
+			"expecting %d attempts, %d executed",
+			DefaultChildManifestRetries+1, attempts,
+		)
+	}
+
+	// failures of any other nature are not retried.
+	attempts = 0
+	if _, err := copyWithRetries(
+		context.Background(), DefaultChildManifestRetries,
+		func() ([]byte, error) {
+			attempts++
+			return nil, fmt.Errorf("connection refused")
+		},
+	); err == nil {
+		t.Error("expecting error, nil received")
+	}
+	if attempts != 1 {
+		t.Errorf("expecting 1 attempt, %d executed", attempts)
+	}
+}
+
+// TestLoadPreservesProvenance guarantees that mirroring an image does not alter its config
+// blob: creation timestamp and build history read from the mirror must match the source so
+// consumers see the same provenance on both ends.
+func TestLoadPreservesProvenance(t *testing.T) {
+	regaddr, regcleanup := NewTestRegistry(t)
+	defer regcleanup()
+
+	srcref, srccleanup := newOCILayout(t)
+	defer srccleanup()
+
+	pol := &signature.Policy{
+		Default: signature.PolicyRequirements{
+			signature.NewPRInsecureAcceptAnything(),
+		},
+	}
+	polctx, err := signature.NewPolicyContext(pol)
+	if err != nil {
+		t.Fatalf("error creating policy context: %s", err)
+	}
+
+	sysctx := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	ctx := context.Background()
+	istore := NewRegistry(regaddr, "", sysctx, polctx)
+	loadref, err := istore.Load(ctx, srcref, nil, "ns", "img")
+	if err != nil {
+		t.Fatalf("unexpected error loading image: %s", err)
+	}
+
+	configFor := func(ref types.ImageReference, refctx *types.SystemContext) *imgspecv1.Image {
+		img, err := ref.NewImage(ctx, refctx)
+		if err != nil {
+			t.Fatalf("error creating image closer: %s", err)
+		}
+		defer img.Close()
+
+		conf, err := img.OCIConfig(ctx)
+		if err != nil {
+			t.Fatalf("error reading image config: %s", err)
+		}
+		return conf
+	}
+
+	srcconf := configFor(srcref, nil)
+	dstconf := configFor(loadref, sysctx)
+
+	if srcconf.Created == nil || dstconf.Created == nil {
+		t.Fatal("missing created timestamp on source or mirrored image")
+	}
+	if !srcconf.Created.Equal(*dstconf.Created) {
+		t.Errorf(
+			"created timestamp changed during mirror: %s != %s",
+			srcconf.Created, dstconf.Created,
+		)
+	}
+
+	if len(srcconf.History) == 0 || len(srcconf.History) != len(dstconf.History) {
+		t.Fatalf(
+			"history changed during mirror: %d entries, %d found",
+			len(srcconf.History), len(dstconf.History),
+		)
+	}
+	for idx, entry := range srcconf.History {
+		if entry.CreatedBy != dstconf.History[idx].CreatedBy {
+			t.Errorf(
+				"history entry %d changed during mirror: %q != %q",
+				idx, entry.CreatedBy, dstconf.History[idx].CreatedBy,
+			)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imagestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/google/uuid"
+)
+
+// testRegistry is a minimal in-memory implementation of the docker registry v2 protocol,
+// just enough of it to be usable as source and destination during image copies. It exists
+// so tests can exercise Load and Save hermetically, without reaching out to a registry in
+// the wild. Blobs are stored globally (keyed by digest), manifests are kept per repository
+// and indexed both by tag and by digest.
+type testRegistry struct {
+	mtx       sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string]map[string]testManifest
+}
+
+// testManifest groups a manifest raw content with its media type.
+type testManifest struct {
+	mediaType string
+	content   []byte
+}
+
+var (
+	testBlobRegexp     = regexp.MustCompile(`^/v2/(.+)/blobs/([a-z0-9]+:[a-f0-9]+)$`)
+	testUploadRegexp   = regexp.MustCompile(`^/v2/(.+)/blobs/uploads/([a-f0-9-]*)$`)
+	testManifestRegexp = regexp.MustCompile(`^/v2/(.+)/manifests/(.+)$`)
+)
+
+// NewTestRegistry spins up an in-process registry hosted at a random port in the loopback
+// interface, returning its address (host:port) and a function callers must invoke to tear
+// it down. The registry speaks plain http so tests need to flag it as insecure.
+func NewTestRegistry(t *testing.T) (string, CleanFn) {
+	t.Helper()
+	reg := &testRegistry{
+		blobs:     map[string][]byte{},
+		uploads:   map[string][]byte{},
+		manifests: map[string]map[string]testManifest{},
+	}
+	srv := httptest.NewServer(reg)
+	addr := strings.TrimPrefix(srv.URL, "http://")
+	return addr, srv.Close
+}
+
+// ServeHTTP dispatches registry requests to the appropriate handler.
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	path := req.URL.Path
+	switch {
+	case path == "/v2/" || path == "/v2":
+		w.WriteHeader(http.StatusOK)
+	case testUploadRegexp.MatchString(path):
+		r.serveUpload(w, req)
+	case testBlobRegexp.MatchString(path):
+		r.serveBlob(w, req)
+	case testManifestRegexp.MatchString(path):
+		r.serveManifest(w, req)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// serveUpload handles the blob upload dance: a POST initiates an upload session, PATCH
+// requests append data to it and a final PUT (carrying the expected digest in a query
+// parameter) promotes the uploaded content into a blob.
+func (r *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request) {
+	matches := testUploadRegexp.FindStringSubmatch(req.URL.Path)
+	name, uid := matches[1], matches[2]
+
+	switch req.Method {
+	case http.MethodPost:
+		uid := uuid.New().String()
+		r.uploads[uid] = []byte{}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, uid))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPatch:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.uploads[uid] = append(r.uploads[uid], content...)
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", name, uid))
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(r.uploads[uid])-1))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		content = append(r.uploads[uid], content...)
+		delete(r.uploads, uid)
+
+		dgst := req.URL.Query().Get("digest")
+		if dgst == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[dgst] = content
+		w.Header().Set("Docker-Content-Digest", dgst)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// serveBlob handles blob existence checks and downloads.
+func (r *testRegistry) serveBlob(w http.ResponseWriter, req *http.Request) {
+	matches := testBlobRegexp.FindStringSubmatch(req.URL.Path)
+	dgst := matches[2]
+
+	content, ok := r.blobs[dgst]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+	w.Header().Set("Docker-Content-Digest", dgst)
+	w.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(content)
+	}
+}
+
+// serveManifest stores and serves image manifests. Manifests pushed by tag are indexed
+// by their digest as well so they can be fetched back either way.
+func (r *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request) {
+	matches := testManifestRegexp.FindStringSubmatch(req.URL.Path)
+	name, ref := matches[1], matches[2]
+
+	switch req.Method {
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		dgst, err := manifest.Digest(content)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if r.manifests[name] == nil {
+			r.manifests[name] = map[string]testManifest{}
+		}
+		entry := testManifest{
+			mediaType: req.Header.Get("Content-Type"),
+			content:   content,
+		}
+		r.manifests[name][ref] = entry
+		r.manifests[name][dgst.String()] = entry
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodGet, http.MethodHead:
+		entry, ok := r.manifests[name][ref]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		dgst, err := manifest.Digest(entry.content)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", entry.mediaType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(entry.content)))
+		w.Header().Set("Docker-Content-Digest", dgst.String())
+		w.WriteHeader(http.StatusOK)
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(entry.content)
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
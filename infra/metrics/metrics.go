@@ -61,6 +61,12 @@ var (
 			Help: "Current number of running image imports workers",
 		},
 	)
+	WorkerWaits = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "tagger_import_worker_wait_total",
+			Help: "Number of times an import had to wait for a free worker",
+		},
+	)
 	MirrorLatency = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "tagger_mirror_latency",
@@ -68,6 +74,44 @@ var (
 			Buckets: []float64{5, 10, 15, 20, 30, 45, 60, 90, 120, 150, 180, 300, 600},
 		},
 	)
+	NamespaceImportSuccesses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tagger_namespace_import_success",
+			Help: "The number of image import successes broken down by namespace",
+		},
+		[]string{"namespace"},
+	)
+	NamespaceImportFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tagger_namespace_import_failures",
+			Help: "The number of image import failures broken down by namespace",
+		},
+		[]string{"namespace"},
+	)
+	MirrorUniqueLayers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tagger_mirror_unique_layers",
+			Help: "Number of distinct layers referenced by mirrored images",
+		},
+	)
+	MirrorTotalLayers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tagger_mirror_total_layers",
+			Help: "Total number of layers referenced by mirrored images",
+		},
+	)
+	MirrorReachable = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tagger_mirror_reachable",
+			Help: "Whether the last probe against the mirror registry succeeded",
+		},
+	)
+	MirrorLastCheckTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "tagger_mirror_last_check_timestamp",
+			Help: "Unix timestamp of the last probe against the mirror registry",
+		},
+	)
 )
 
 func init() {
@@ -81,6 +125,13 @@ func init() {
 		PullFailures,
 		PullLatency,
 		ActiveWorkers,
+		WorkerWaits,
 		MirrorLatency,
+		NamespaceImportSuccesses,
+		NamespaceImportFailures,
+		MirrorUniqueLayers,
+		MirrorTotalLayers,
+		MirrorReachable,
+		MirrorLastCheckTimestamp,
 	)
 }
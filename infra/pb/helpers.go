@@ -19,6 +19,41 @@ import (
 	"io"
 )
 
+// Chunk size bounds honored by Send. Sizes outside of these bounds are clamped, protecting
+// the receiving end from absurdly large messages while leaving some room for tuning.
+const (
+	MinChunkSize     = 1024
+	MaxChunkSize     = 1 << 20
+	DefaultChunkSize = MinChunkSize
+)
+
+// SendOption is a function that tweaks the behavior of a Send call.
+type SendOption func(*sendOptions)
+
+// sendOptions gathers all tunable knobs honored by Send.
+type sendOptions struct {
+	chunkSize int
+}
+
+// WithChunkSize makes Send split content into chunks of provided size, in bytes. The size
+// is clamped into the [MinChunkSize, MaxChunkSize] interval.
+func WithChunkSize(size int) SendOption {
+	return func(o *sendOptions) {
+		o.chunkSize = clampChunkSize(size)
+	}
+}
+
+// clampChunkSize fits provided chunk size into the [MinChunkSize, MaxChunkSize] interval.
+func clampChunkSize(size int) int {
+	if size < MinChunkSize {
+		return MinChunkSize
+	}
+	if size > MaxChunkSize {
+		return MaxChunkSize
+	}
+	return size
+}
+
 // PacketReceiver is anything capable of receiving a Packet.
 type PacketReceiver interface {
 	Recv() (*Packet, error)
@@ -93,13 +128,25 @@ func Receive(from PacketReceiver, to io.Writer, tracker ProgressTracker) error {
 }
 
 // Send sends contents of provided Reader through a PacketSender. Content is split into chunks
-// of 1024 bytes. From time to time this function also sends over the wire a progress message,
-// informing the total file size and the current offset.
-func Send(from io.Reader, totalSize int64, to PacketSender, tracker ProgressTracker) error {
+// of DefaultChunkSize bytes, use WithChunkSize to tune this. From time to time this function
+// also sends over the wire a progress message, informing the total file size and the current
+// offset.
+func Send(
+	from io.Reader,
+	totalSize int64,
+	to PacketSender,
+	tracker ProgressTracker,
+	opts ...SendOption,
+) error {
+	so := sendOptions{chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(&so)
+	}
+
 	var counter int
 	var totread int64
 	for {
-		content := make([]byte, 1024)
+		content := make([]byte, so.chunkSize)
 		read, err := from.Read(content)
 		if err != nil {
 			if err == io.EOF {
@@ -119,7 +166,7 @@ func Send(from io.Reader, totalSize int64, to PacketSender, tracker ProgressTrac
 		pckt := &Packet{
 			TestOneof: &Packet_Chunk{
 				Chunk: &Chunk{
-					Content: content,
+					Content: content[:read],
 				},
 			},
 		}
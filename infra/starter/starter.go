@@ -17,6 +17,7 @@ package starter
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"sync"
 	"time"
@@ -95,6 +96,50 @@ func (s *Starter) OnStoppedLeading() {
 	s.wg.Wait()
 }
 
+// StepDown makes us gracefully release the leader lease, ending all running controllers so
+// another replica can take over. Useful for controlled failovers and for draining a node
+// ahead of maintenance without a hard pod restart.
+func (s *Starter) StepDown() {
+	klog.Info("step down requested, releasing leader lease.")
+	s.cancel()
+}
+
+// stepDownServer spawns a small admin http server through which operators can request the
+// current leader to step down (POST /stepdown). The server binds to loopback only, this is
+// the guard here: the port is never exposed outside the pod, requests come in through
+// "kubectl exec".
+func (s *Starter) stepDownServer(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stepdown", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		fmt.Fprintln(w, "stepping down")
+		go s.StepDown()
+	})
+
+	server := &http.Server{
+		Addr:    "127.0.0.1:8091",
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			klog.Errorf("error shutting down step down server: %s", err)
+		}
+	}()
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.Errorf("step down server failed: %s", err)
+		}
+	}()
+}
+
 // startController calls Start() in a Controller.
 func (s *Starter) startController(ctx context.Context, c Controller) {
 	defer s.wg.Done()
@@ -116,6 +161,8 @@ func (s *Starter) Start(ctx context.Context, lockID string) error {
 	// a Start() call.
 	ctx, s.cancel = context.WithCancel(ctx)
 
+	s.stepDownServer(ctx)
+
 	lock, err := resourcelock.New(
 		resourcelock.ConfigMapsResourceLock,
 		s.namespace,
@@ -132,11 +179,14 @@ func (s *Starter) Start(ctx context.Context, lockID string) error {
 
 	election, err := leaderelection.NewLeaderElector(
 		leaderelection.LeaderElectionConfig{
-			Lock:            lock,
-			LeaseDuration:   time.Minute,
-			RenewDeadline:   10 * time.Second,
-			RetryPeriod:     2 * time.Second,
-			ReleaseOnCancel: false,
+			Lock:          lock,
+			LeaseDuration: time.Minute,
+			RenewDeadline: 10 * time.Second,
+			RetryPeriod:   2 * time.Second,
+			// release the lease when our context is cancelled (be it by a step
+			// down request or a regular shutdown), other replicas take over
+			// right away instead of waiting for the lease to expire.
+			ReleaseOnCancel: true,
 			Callbacks: leaderelection.LeaderCallbacks{
 				OnStartedLeading: s.OnStartedLeading,
 				OnStoppedLeading: s.OnStoppedLeading,
@@ -0,0 +1,248 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	appslist "k8s.io/client-go/listers/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/hashicorp/go-multierror"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgclient "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+	imglist "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/listers/images/v1beta1"
+)
+
+// AutoImportAnnotation is the annotation users set in a Deployment to opt in for automatic
+// Image creation for all container images referenced by the Deployment. Clusters where this
+// key collides with another tool may override it through the AUTO_IMPORT_ANNOTATION env
+// variable, read once at startup.
+var AutoImportAnnotation = "tagger.dev/auto-import"
+
+// MaxImageConsumers caps the number of Deployment names we record in an Image status as
+// consumers. Namespaces with more deployments referencing the same image only get the
+// first ones (alphabetically), this status field is impact analysis data, not inventory.
+var MaxImageConsumers = 10
+
+// Deployment gather all actions related to deployment objects. Deployments may opt in for
+// automatic imports by mean of an annotation, for those we guarantee an Image object exists
+// for every container image they refer to.
+type Deployment struct {
+	corinf     informers.SharedInformerFactory
+	deplis     appslist.DeploymentLister
+	imglis     imglist.ImageLister
+	imgcli     imgclient.Interface
+	syssvc     *SysContext
+	annotation string
+}
+
+// NewDeployment returns a handler for all Deployment related services. As in the other
+// services in this package parameters may be nil, it is up to the caller to provide what
+// is needed for each specific use case. The opt in annotation key is resolved here, once,
+// from the environment.
+func NewDeployment(
+	corinf informers.SharedInformerFactory,
+	imgcli imgclient.Interface,
+	imginf imginform.SharedInformerFactory,
+) *Deployment {
+	var deplis appslist.DeploymentLister
+	if corinf != nil {
+		deplis = corinf.Apps().V1().Deployments().Lister()
+	}
+
+	var imglis imglist.ImageLister
+	if imginf != nil {
+		imglis = imginf.Tagger().V1beta1().Images().Lister()
+	}
+
+	annotation := os.Getenv("AUTO_IMPORT_ANNOTATION")
+	if annotation == "" {
+		annotation = AutoImportAnnotation
+	}
+
+	return &Deployment{
+		corinf:     corinf,
+		deplis:     deplis,
+		imglis:     imglis,
+		imgcli:     imgcli,
+		syssvc:     NewSysContext(corinf),
+		annotation: annotation,
+	}
+}
+
+// Sync guarantees that for every container image referenced by provided Deployment there is
+// an Image object in its namespace. This is strictly opt-in, Deployments without the auto
+// import annotation are ignored. Images already in place are left untouched.
+func (d *Deployment) Sync(ctx context.Context, dep *appsv1.Deployment) error {
+	if d.syssvc.Paused() {
+		klog.Warningf(
+			"reconciliation paused through operator config, skipping deployment %s/%s",
+			dep.Namespace, dep.Name,
+		)
+		return nil
+	}
+
+	// consumer bookkeeping is best effort, an Image status slightly out of date must
+	// never block a deployment sync.
+	d.refreshImageConsumers(ctx, dep.Namespace)
+
+	if dep.Annotations[d.annotation] != "true" {
+		return nil
+	}
+
+	var errors *multierror.Error
+	for _, cont := range dep.Spec.Template.Spec.Containers {
+		if err := d.ensureImage(ctx, dep.Namespace, cont.Image); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+	return errors.ErrorOrNil()
+}
+
+// refreshImageConsumers records, in the status of every Image in the namespace, the names
+// of the Deployments currently referencing the image. This gives operators the blast
+// radius of changing an Image at a glance. The list is eventually consistent, we refresh
+// it whenever a deployment in the namespace is synced, and capped at MaxImageConsumers
+// entries.
+func (d *Deployment) refreshImageConsumers(ctx context.Context, namespace string) {
+	deps, err := d.deplis.Deployments(namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("unable to list deployments in %s: %s", namespace, err)
+		return
+	}
+
+	consumers := map[string]map[string]bool{}
+	for _, dep := range deps {
+		for _, cont := range dep.Spec.Template.Spec.Containers {
+			name, err := imageNameForReference(cont.Image)
+			if err != nil {
+				continue
+			}
+			if consumers[name] == nil {
+				consumers[name] = map[string]bool{}
+			}
+			consumers[name][dep.Name] = true
+		}
+	}
+
+	imgs, err := d.imglis.Images(namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("unable to list images in %s: %s", namespace, err)
+		return
+	}
+
+	for _, img := range imgs {
+		var names []string
+		for name := range consumers[img.Name] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > MaxImageConsumers {
+			names = names[:MaxImageConsumers]
+		}
+
+		if reflect.DeepEqual(img.Status.Consumers, names) {
+			continue
+		}
+
+		if _, err := updateImageStatus(
+			ctx, d.imgcli, img.DeepCopy(), func(img *imgv1b1.Image) {
+				img.Status.Consumers = names
+			},
+		); err != nil {
+			klog.Errorf(
+				"unable to update consumers for image %s/%s: %s",
+				namespace, img.Name, err,
+			)
+		}
+	}
+}
+
+// ensureImage creates an Image object tracking provided container image reference if one
+// does not exist yet in the namespace.
+func (d *Deployment) ensureImage(ctx context.Context, namespace, imgpath string) error {
+	name, err := imageNameForReference(imgpath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.imglis.Images(namespace).Get(name); err == nil {
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to get image %s/%s: %w", namespace, name, err)
+	}
+
+	img := &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: imgv1b1.ImageSpec{
+			From: imgpath,
+		},
+	}
+	if _, err := d.imgcli.TaggerV1beta1().Images(namespace).Create(
+		ctx, img, metav1.CreateOptions{},
+	); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to create image %s/%s: %w", namespace, name, err)
+	}
+
+	klog.Infof("image %s/%s created for %s", namespace, name, imgpath)
+	return nil
+}
+
+// imageNameForReference derives an Image object name from a container image reference, e.g.
+// for quay.io/repo/myapp:latest this returns myapp.
+func imageNameForReference(imgpath string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imgpath)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %w", imgpath, err)
+	}
+
+	slices := strings.Split(reference.Path(named), "/")
+	return slices[len(slices)-1], nil
+}
+
+// Get returns a Deployment object. Returned object is already a copy of the cached object
+// and may be modified by caller as needed.
+func (d *Deployment) Get(ctx context.Context, ns, name string) (*appsv1.Deployment, error) {
+	dep, err := d.deplis.Deployments(ns).Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get deployment: %w", err)
+	}
+	return dep.DeepCopy(), nil
+}
+
+// AddEventHandler adds a handler to Deployment related events.
+func (d *Deployment) AddEventHandler(handler cache.ResourceEventHandler) {
+	d.corinf.Apps().V1().Deployments().Informer().AddEventHandler(handler)
+}
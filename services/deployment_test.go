@@ -0,0 +1,418 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreinf "k8s.io/client-go/informers"
+	corfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgfake "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned/fake"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+)
+
+func TestDeploymentSync(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		annotation string
+		dep        *appsv1.Deployment
+		imgObjects []runtime.Object
+		expImages  []string
+	}{
+		{
+			name: "deployment without annotation",
+			dep: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Image: "quay.io/repo/myapp:latest"},
+							},
+						},
+					},
+				},
+			},
+			expImages: []string{},
+		},
+		{
+			name: "opted in deployment",
+			dep: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+					Annotations: map[string]string{
+						AutoImportAnnotation: "true",
+					},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Image: "quay.io/repo/myapp:latest"},
+								{Image: "quay.io/repo/sidecar:latest"},
+							},
+						},
+					},
+				},
+			},
+			expImages: []string{"myapp", "sidecar"},
+		},
+		{
+			name: "image already exists",
+			dep: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+					Annotations: map[string]string{
+						AutoImportAnnotation: "true",
+					},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Image: "quay.io/repo/myapp:latest"},
+							},
+						},
+					},
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "docker.io/library/centos:latest",
+					},
+				},
+			},
+			expImages: []string{"myapp"},
+		},
+		{
+			name:       "custom annotation key",
+			annotation: "acme.io/image-import",
+			dep: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+					Annotations: map[string]string{
+						"acme.io/image-import": "true",
+					},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Image: "quay.io/repo/myapp:latest"},
+							},
+						},
+					},
+				},
+			},
+			expImages: []string{"myapp"},
+		},
+		{
+			name:       "default key ignored when a custom key is set",
+			annotation: "acme.io/image-import",
+			dep: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+					Annotations: map[string]string{
+						AutoImportAnnotation: "true",
+					},
+				},
+				Spec: appsv1.DeploymentSpec{
+					Template: corev1.PodTemplateSpec{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{Image: "quay.io/repo/myapp:latest"},
+							},
+						},
+					},
+				},
+			},
+			expImages: []string{},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.annotation != "" {
+				t.Setenv("AUTO_IMPORT_ANNOTATION", tt.annotation)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			corcli := corfake.NewSimpleClientset()
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			imgcli := imgfake.NewSimpleClientset(tt.imgObjects...)
+			imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+			svc := NewDeployment(corinf, imgcli, imginf)
+
+			corinf.Start(ctx.Done())
+			imginf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Apps().V1().Deployments().Informer().HasSynced,
+				imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			if err := svc.Sync(ctx, tt.dep); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			imgs, err := imgcli.TaggerV1beta1().Images(tt.dep.Namespace).List(
+				ctx, metav1.ListOptions{},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error listing images: %s", err)
+			}
+			if len(imgs.Items) != len(tt.expImages) {
+				t.Fatalf(
+					"expecting %d images, %d found",
+					len(tt.expImages), len(imgs.Items),
+				)
+			}
+
+			found := map[string]bool{}
+			for _, img := range imgs.Items {
+				found[img.Name] = true
+			}
+			for _, name := range tt.expImages {
+				if !found[name] {
+					t.Errorf("expected image %s not found", name)
+				}
+			}
+		})
+	}
+}
+
+func Test_imageNameForReference(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		imgpath string
+		exp     string
+		err     bool
+	}{
+		{
+			name:    "fully qualified reference",
+			imgpath: "quay.io/repo/myapp:latest",
+			exp:     "myapp",
+		},
+		{
+			name:    "unqualified reference",
+			imgpath: "centos:latest",
+			exp:     "centos",
+		},
+		{
+			name:    "reference by digest",
+			imgpath: "quay.io/repo/myapp@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			exp:     "myapp",
+		},
+		{
+			name:    "invalid reference",
+			imgpath: "in valid",
+			err:     true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := imageNameForReference(tt.imgpath)
+			if err != nil {
+				if !tt.err {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+			if tt.err {
+				t.Error("expecting error, nil received")
+			}
+			if res != tt.exp {
+				t.Errorf("expected %q, received %q", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_refreshImageConsumers(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		depObjects   []runtime.Object
+		imgObjects   []runtime.Object
+		expConsumers map[string][]string
+	}{
+		{
+			name: "no deployments",
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+					},
+				},
+			},
+			expConsumers: map[string][]string{
+				"myapp": nil,
+			},
+		},
+		{
+			name: "multiple deployments referencing the same image",
+			depObjects: []runtime.Object{
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "frontend",
+					},
+					Spec: appsv1.DeploymentSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{
+									{Image: "quay.io/repo/myapp:latest"},
+								},
+							},
+						},
+					},
+				},
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "backend",
+					},
+					Spec: appsv1.DeploymentSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{
+									{Image: "quay.io/repo/myapp:latest"},
+									{Image: "quay.io/repo/other:latest"},
+								},
+							},
+						},
+					},
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+					},
+				},
+			},
+			expConsumers: map[string][]string{
+				"myapp": {"backend", "frontend"},
+			},
+		},
+		{
+			name: "stale consumer removed",
+			depObjects: []runtime.Object{
+				&appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "frontend",
+					},
+					Spec: appsv1.DeploymentSpec{
+						Template: corev1.PodTemplateSpec{
+							Spec: corev1.PodSpec{
+								Containers: []corev1.Container{
+									{Image: "quay.io/repo/other:latest"},
+								},
+							},
+						},
+					},
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+					},
+					Status: imgv1b1.ImageStatus{
+						Consumers: []string{"frontend"},
+					},
+				},
+			},
+			expConsumers: map[string][]string{
+				"myapp": nil,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			corcli := corfake.NewSimpleClientset(tt.depObjects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			imgcli := imgfake.NewSimpleClientset(tt.imgObjects...)
+			imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+			svc := NewDeployment(corinf, imgcli, imginf)
+
+			corinf.Start(ctx.Done())
+			imginf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Apps().V1().Deployments().Informer().HasSynced,
+				imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			svc.refreshImageConsumers(ctx, "default")
+
+			for name, exp := range tt.expConsumers {
+				img, err := imgcli.TaggerV1beta1().Images("default").Get(
+					ctx, name, metav1.GetOptions{},
+				)
+				if err != nil {
+					t.Fatalf("unexpected error getting image: %s", err)
+				}
+				if len(img.Status.Consumers) != len(exp) {
+					t.Fatalf(
+						"expecting %d consumers on %s, %d found",
+						len(exp), name, len(img.Status.Consumers),
+					)
+				}
+				for i, dep := range exp {
+					if img.Status.Consumers[i] != dep {
+						t.Errorf(
+							"expecting consumer %s, found %s",
+							dep, img.Status.Consumers[i],
+						)
+					}
+				}
+			}
+		})
+	}
+}
@@ -18,12 +18,15 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
 	imgclient "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
@@ -31,6 +34,10 @@ import (
 	imglist "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/listers/images/v1beta1"
 )
 
+// ImportFlagWorkers is the number of simultaneous api calls we do when flagging already
+// consumed ImageImports for deletion during an Image sync.
+var ImportFlagWorkers = 5
+
 // Image gather all actions related to image img objects.
 type Image struct {
 	imgcli imgclient.Interface
@@ -38,6 +45,9 @@ type Image struct {
 	implis imglist.ImageImportLister
 	imginf imginform.SharedInformerFactory
 	syssvc *SysContext
+
+	statmtx    sync.Mutex
+	layerstats LayerStats
 }
 
 // NewImage returns a handler for all image img related services. I have chosen to go with a lazy
@@ -112,6 +122,30 @@ func (t *Image) RecentlyFinishedImports(
 // in place before updating it on api server, i.e. use DeepCopy() before passing the image object
 // in.
 func (t *Image) Sync(ctx context.Context, img *imgv1b1.Image) error {
+	if t.syssvc.Paused() {
+		klog.Warningf(
+			"reconciliation paused through operator config, skipping image %s/%s",
+			img.Namespace, img.Name,
+		)
+		return nil
+	}
+
+	// ephemeral Images may carry a TTL counted from their last import, once it is
+	// exceeded we delete the object keeping the cluster clean of short lived images
+	// without external cron jobs.
+	if img.TTLExceeded() {
+		klog.Infof(
+			"image %s/%s exceeded its ttl of %s, deleting",
+			img.Namespace, img.Name, img.Spec.TTLAfterLastImport,
+		)
+		if err := t.imgcli.TaggerV1beta1().Images(img.Namespace).Delete(
+			ctx, img.Name, metav1.DeleteOptions{},
+		); err != nil {
+			return fmt.Errorf("unable to delete expired image: %w", err)
+		}
+		return nil
+	}
+
 	var err error
 
 	newimports, err := t.RecentlyFinishedImports(ctx, img)
@@ -119,29 +153,64 @@ func (t *Image) Sync(ctx context.Context, img *imgv1b1.Image) error {
 		return fmt.Errorf("unable to read image imports: %w", err)
 	}
 
-	img.PrependFinishedImports(newimports)
-
-	if _, err = t.imgcli.TaggerV1beta1().Images(img.Namespace).UpdateStatus(
-		ctx, img, metav1.UpdateOptions{},
+	if _, err = updateImageStatus(
+		ctx, t.imgcli, img, func(img *imgv1b1.Image) {
+			// images requiring approval hold new references as pending until a
+			// human flips them through Approve. The very first import always
+			// goes through, an Image without any reference is unusable.
+			if img.Spec.RequireApproval && len(img.Status.HashReferences) > 0 {
+				img.HoldFinishedImports(newimports)
+				return
+			}
+			img.PrependFinishedImports(newimports)
+		},
 	); err != nil {
 		return fmt.Errorf("error updating image: %w", err)
 	}
 
 	// Now that we have successfully saved the ImageImports inside the Image object we
-	// can flag them for deletion. We ignore any errors here, the flagging process will
-	// be retried during next Sync call.
+	// can flag them for deletion. We tolerate errors here, the flagging process will
+	// be retried during next Sync call. High churn Images may accumulate a good number
+	// of imports so we flag them in parallel, bounded by ImportFlagWorkers.
+	var wg sync.WaitGroup
+	var failmtx sync.Mutex
+	var failures int
+	tokens := make(chan struct{}, ImportFlagWorkers)
 	for _, imp := range newimports {
+		imp := imp
 		imp.FlagAsConsumed()
-		if _, err := t.imgcli.TaggerV1beta1().ImageImports(img.Namespace).Update(
-			ctx, &imp, metav1.UpdateOptions{},
-		); err != nil {
-			klog.V(5).Infof(
-				"unable to flag image import for deletion %s/%s: %s",
-				imp.Namespace,
-				imp.Name,
-				err,
-			)
-		}
+
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func() {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			if _, err := t.imgcli.TaggerV1beta1().ImageImports(img.Namespace).Update(
+				ctx, &imp, metav1.UpdateOptions{},
+			); err != nil {
+				klog.V(5).Infof(
+					"unable to flag image import for deletion %s/%s: %s",
+					imp.Namespace,
+					imp.Name,
+					err,
+				)
+
+				failmtx.Lock()
+				failures++
+				failmtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failures > 0 {
+		klog.Warningf(
+			"failed to flag %d of %d image imports for deletion in %s/%s, retrying next sync",
+			failures, len(newimports), img.Namespace, img.Name,
+		)
 	}
 
 	return nil
@@ -160,7 +229,132 @@ func (t *Image) Get(ctx context.Context, ns, name string) (*imgv1b1.Image, error
 // Validate checks if provided Image contains all mandatory fields. At this stage we only verify
 // if it contain the necessary fields.
 func (t *Image) Validate(ctx context.Context, img *imgv1b1.Image) error {
-	return img.Validate()
+	if err := img.Validate(); err != nil {
+		return err
+	}
+	if err := validateManifestType(img.Spec.MirrorManifestType); err != nil {
+		return err
+	}
+	for _, from := range append([]string{img.Spec.From}, img.Spec.Sources...) {
+		if from == "" {
+			continue
+		}
+		if err := t.syssvc.ValidateSourceRegistry(ctx, from); err != nil {
+			return err
+		}
+	}
+	return validatePlatform(img.Spec.Platform)
+}
+
+// PromoteOpts holds the options necessary to call Image.Promote().
+type PromoteOpts struct {
+	SourceNamespace string
+	TargetNamespace string
+	Name            string
+	StableFor       time.Duration
+}
+
+// Promote copies the image currently pointed by an Image in one namespace into another
+// namespace by means of an ImageImport in the destination namespace. The copy happens
+// inside the mirror registry, no image data flows through this process. If StableFor is
+// set the promotion only takes place when the source reference has not changed for at
+// least the provided duration, otherwise an error naming the remaining wait is returned.
+func (t *Image) Promote(ctx context.Context, o PromoteOpts) (*imgv1b1.ImageImport, error) {
+	if o.SourceNamespace == o.TargetNamespace {
+		return nil, fmt.Errorf("source and destination namespaces are the same")
+	}
+
+	img, err := t.imgcli.TaggerV1beta1().Images(o.SourceNamespace).Get(
+		ctx, o.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting image: %w", err)
+	}
+
+	imgref := img.CurrentReferenceForImage()
+	if len(imgref) == 0 {
+		return nil, fmt.Errorf("image %s/%s not imported yet", o.SourceNamespace, o.Name)
+	}
+
+	if o.StableFor > 0 {
+		stable := time.Since(img.Status.HashReferences[0].ImportedAt.Time)
+		if stable < o.StableFor {
+			return nil, fmt.Errorf(
+				"image %s/%s changed %s ago, wait %s more before promoting",
+				o.SourceNamespace, o.Name,
+				stable.Round(time.Second),
+				(o.StableFor - stable).Round(time.Second),
+			)
+		}
+	}
+
+	tisvc := NewImageImport(nil, t.imgcli, nil)
+	return tisvc.NewImport(
+		ctx, ImportOpts{
+			Namespace:   o.TargetNamespace,
+			TargetImage: o.Name,
+			From:        imgref,
+			Mirror:      pointer.Bool(true),
+			Insecure:    pointer.Bool(img.Spec.Insecure),
+		},
+	)
+}
+
+// Approve flips an Image pending reference into its active one, see spec.requireApproval.
+// Returns the updated Image or an error when there is nothing pending approval.
+func (t *Image) Approve(ctx context.Context, ns, name string) (*imgv1b1.Image, error) {
+	img, err := t.imgcli.TaggerV1beta1().Images(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting image: %w", err)
+	}
+
+	if img.Status.PendingReference == nil {
+		return nil, fmt.Errorf(
+			"image %s/%s has no reference pending approval", ns, name,
+		)
+	}
+
+	img, err = updateImageStatus(
+		ctx, t.imgcli, img, func(img *imgv1b1.Image) {
+			img.ApprovePendingReference()
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating image: %w", err)
+	}
+	return img, nil
+}
+
+// Rollback makes an Image point again to the reference it pointed to before the most
+// recent import, a single step "undo". The previous reference is re-imported as a new
+// generation so the full history remains recorded in the Image status. An error is
+// returned when there is no previous reference to roll back to.
+func (t *Image) Rollback(ctx context.Context, ns, name string) (*imgv1b1.ImageImport, error) {
+	img, err := t.imgcli.TaggerV1beta1().Images(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting image: %w", err)
+	}
+
+	if len(img.Status.HashReferences) == 0 {
+		return nil, fmt.Errorf("image %s/%s not imported yet", ns, name)
+	}
+	if len(img.Status.HashReferences) < 2 {
+		return nil, fmt.Errorf(
+			"image %s/%s already points to its oldest known reference", ns, name,
+		)
+	}
+
+	prevref := img.Status.HashReferences[1].ImageReference
+	tisvc := NewImageImport(nil, t.imgcli, nil)
+	return tisvc.NewImport(
+		ctx, ImportOpts{
+			Namespace:   ns,
+			TargetImage: name,
+			From:        prevref,
+			Mirror:      pointer.Bool(img.Spec.Mirror),
+			Insecure:    pointer.Bool(img.Spec.Insecure),
+		},
+	)
 }
 
 // AddEventHandler adds a handler to Image related events.
@@ -173,6 +367,7 @@ type NewImageOpts struct {
 	Namespace string
 	Name      string
 	From      string
+	Sources   []string
 	Mirror    bool
 	Insecure  bool
 }
@@ -185,6 +380,7 @@ func (t *Image) NewImage(ctx context.Context, o NewImageOpts) (*imgv1b1.Image, e
 		},
 		Spec: imgv1b1.ImageSpec{
 			From:     o.From,
+			Sources:  o.Sources,
 			Mirror:   o.Mirror,
 			Insecure: o.Insecure,
 		},
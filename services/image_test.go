@@ -0,0 +1,543 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreinf "k8s.io/client-go/informers"
+	corfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/pointer"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgfake "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned/fake"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+)
+
+// TestImageSyncIsolation guarantees two Images pointing to the same source but with
+// different settings (mirror against non mirror) do not cross contaminate each other's
+// bookkeeping: every Image only catalogues (and flags as consumed) the imports it owns.
+func TestImageSyncIsolation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mirrored := &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "myapp-mirrored",
+			UID:       "uid-mirrored",
+		},
+		Spec: imgv1b1.ImageSpec{
+			From:   "quay.io/repo/myapp:latest",
+			Mirror: true,
+		},
+	}
+	plain := &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "myapp-plain",
+			UID:       "uid-plain",
+		},
+		Spec: imgv1b1.ImageSpec{
+			From: "quay.io/repo/myapp:latest",
+		},
+	}
+
+	importFor := func(img *imgv1b1.Image, suffix, ref string) *imgv1b1.ImageImport {
+		return &imgv1b1.ImageImport{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      img.Name + "-" + suffix,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						Kind:       imgv1b1.ImageKind,
+						APIVersion: imgv1b1.GroupVersion,
+						Name:       img.Name,
+						UID:        img.UID,
+					},
+				},
+			},
+			Spec: imgv1b1.ImageImportSpec{
+				TargetImage: img.Name,
+				From:        img.Spec.From,
+				Mirror:      pointer.Bool(img.Spec.Mirror),
+			},
+			Status: imgv1b1.ImageImportStatus{
+				HashReference: &imgv1b1.HashReference{
+					From:           img.Spec.From,
+					ImportedAt:     metav1.NewTime(time.Now()),
+					ImageReference: ref,
+				},
+			},
+		}
+	}
+	impmirrored := importFor(mirrored, "abc12345", "10.1.1.1/repo/myapp@sha256:aaa")
+	impplain := importFor(plain, "def12345", "quay.io/repo/myapp@sha256:bbb")
+
+	fakecli := corfake.NewSimpleClientset()
+	informer := coreinf.NewSharedInformerFactory(fakecli, time.Minute)
+
+	imgcli := imgfake.NewSimpleClientset(mirrored, plain, impmirrored, impplain)
+	imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+	svc := NewImage(informer, imgcli, imginf)
+
+	informer.Start(ctx.Done())
+	imginf.Start(ctx.Done())
+	if !cache.WaitForCacheSync(
+		ctx.Done(),
+		imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+		imginf.Tagger().V1beta1().ImageImports().Informer().HasSynced,
+	) {
+		t.Fatal("errors waiting for caches to sync")
+	}
+
+	for _, img := range []*imgv1b1.Image{mirrored, plain} {
+		if err := svc.Sync(ctx, img.DeepCopy()); err != nil {
+			t.Fatalf("unexpected sync error: %s", err)
+		}
+	}
+
+	for img, expref := range map[*imgv1b1.Image]string{
+		mirrored: "10.1.1.1/repo/myapp@sha256:aaa",
+		plain:    "quay.io/repo/myapp@sha256:bbb",
+	} {
+		res, err := imgcli.TaggerV1beta1().Images("default").Get(
+			ctx, img.Name, metav1.GetOptions{},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error getting image: %s", err)
+		}
+
+		if len(res.Status.HashReferences) != 1 {
+			t.Fatalf(
+				"expecting one reference in %s, %d received",
+				img.Name, len(res.Status.HashReferences),
+			)
+		}
+		if ref := res.Status.HashReferences[0].ImageReference; ref != expref {
+			t.Errorf("image %s catalogued wrong reference %s", img.Name, ref)
+		}
+	}
+
+	// both imports must have been flagged as consumed by their own Image, one
+	// flagging the other's import would be the cross contamination we fear.
+	for _, imp := range []*imgv1b1.ImageImport{impmirrored, impplain} {
+		res, err := imgcli.TaggerV1beta1().ImageImports("default").Get(
+			ctx, imp.Name, metav1.GetOptions{},
+		)
+		if err != nil {
+			t.Fatalf("unexpected error getting import: %s", err)
+		}
+		if !res.FlaggedAsConsumed() {
+			t.Errorf("import %s should have been flagged as consumed", imp.Name)
+		}
+	}
+}
+
+func Test_ImagePromote(t *testing.T) {
+	imgAgedBy := func(age time.Duration) *imgv1b1.Image {
+		return &imgv1b1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "staging",
+				Name:      "myapp",
+			},
+			Spec: imgv1b1.ImageSpec{
+				From:   "quay.io/repo/myapp:latest",
+				Mirror: true,
+			},
+			Status: imgv1b1.ImageStatus{
+				HashReferences: []imgv1b1.HashReference{
+					{
+						ImportedAt:     metav1.NewTime(time.Now().Add(-age)),
+						ImageReference: "quay.io/repo/myapp@sha256:abc",
+					},
+				},
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		img    *imgv1b1.Image
+		opts   PromoteOpts
+		experr string
+	}{
+		{
+			name: "happy path without stability window",
+			img:  imgAgedBy(time.Minute),
+			opts: PromoteOpts{
+				SourceNamespace: "staging",
+				TargetNamespace: "prod",
+				Name:            "myapp",
+			},
+		},
+		{
+			name: "happy path with elapsed stability window",
+			img:  imgAgedBy(time.Hour),
+			opts: PromoteOpts{
+				SourceNamespace: "staging",
+				TargetNamespace: "prod",
+				Name:            "myapp",
+				StableFor:       30 * time.Minute,
+			},
+		},
+		{
+			name: "source reference changed too recently",
+			img:  imgAgedBy(time.Minute),
+			opts: PromoteOpts{
+				SourceNamespace: "staging",
+				TargetNamespace: "prod",
+				Name:            "myapp",
+				StableFor:       30 * time.Minute,
+			},
+			experr: "before promoting",
+		},
+		{
+			name: "source and destination namespaces are equal",
+			img:  imgAgedBy(time.Hour),
+			opts: PromoteOpts{
+				SourceNamespace: "staging",
+				TargetNamespace: "staging",
+				Name:            "myapp",
+			},
+			experr: "namespaces are the same",
+		},
+		{
+			name: "image not imported yet",
+			img: &imgv1b1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "staging",
+					Name:      "myapp",
+				},
+				Spec: imgv1b1.ImageSpec{
+					From: "quay.io/repo/myapp:latest",
+				},
+			},
+			opts: PromoteOpts{
+				SourceNamespace: "staging",
+				TargetNamespace: "prod",
+				Name:            "myapp",
+			},
+			experr: "not imported yet",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			imgcli := imgfake.NewSimpleClientset(tt.img)
+			svc := NewImage(nil, imgcli, nil)
+
+			imp, err := svc.Promote(ctx, tt.opts)
+			if tt.experr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.experr) {
+					t.Errorf("expecting error %q, %v received", tt.experr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if imp.Namespace != tt.opts.TargetNamespace {
+				t.Errorf("import created in wrong namespace %s", imp.Namespace)
+			}
+			if imp.Spec.From != tt.img.CurrentReferenceForImage() {
+				t.Errorf("import points to wrong source %s", imp.Spec.From)
+			}
+			if imp.Spec.Mirror == nil || !*imp.Spec.Mirror {
+				t.Error("expecting a mirror to mirror import")
+			}
+		})
+	}
+}
+
+func Test_ImageRollback(t *testing.T) {
+	refAt := func(ref string, age time.Duration) imgv1b1.HashReference {
+		return imgv1b1.HashReference{
+			ImportedAt:     metav1.NewTime(time.Now().Add(-age)),
+			ImageReference: ref,
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		refs   []imgv1b1.HashReference
+		exp    string
+		experr string
+	}{
+		{
+			name:   "image not imported yet",
+			experr: "not imported yet",
+		},
+		{
+			name: "already at the oldest reference",
+			refs: []imgv1b1.HashReference{
+				refAt("quay.io/repo/myapp@sha256:abc", time.Hour),
+			},
+			experr: "oldest known reference",
+		},
+		{
+			name: "happy path",
+			refs: []imgv1b1.HashReference{
+				refAt("quay.io/repo/myapp@sha256:def", time.Minute),
+				refAt("quay.io/repo/myapp@sha256:abc", time.Hour),
+			},
+			exp: "quay.io/repo/myapp@sha256:abc",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			img := &imgv1b1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp",
+				},
+				Spec: imgv1b1.ImageSpec{
+					From:   "quay.io/repo/myapp:latest",
+					Mirror: true,
+				},
+				Status: imgv1b1.ImageStatus{
+					HashReferences: tt.refs,
+				},
+			}
+
+			imgcli := imgfake.NewSimpleClientset(img)
+			svc := NewImage(nil, imgcli, nil)
+
+			imp, err := svc.Rollback(ctx, "default", "myapp")
+			if tt.experr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.experr) {
+					t.Errorf("expecting error %q, %v received", tt.experr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if imp.Spec.From != tt.exp {
+				t.Errorf("rollback points to wrong reference %s", imp.Spec.From)
+			}
+			if imp.Spec.TargetImage != "myapp" {
+				t.Errorf("rollback targets wrong image %s", imp.Spec.TargetImage)
+			}
+		})
+	}
+}
+
+// Test_ImageSyncFlagsManyImports guarantees that an Image sync flags all of its finished
+// imports as consumed, regardless of how many have piled up.
+func Test_ImageSyncFlagsManyImports(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	img := &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "myapp",
+			UID:       "uid-myapp",
+		},
+		Spec: imgv1b1.ImageSpec{
+			From: "quay.io/repo/myapp:latest",
+		},
+	}
+
+	objects := []runtime.Object{img}
+	for i := 0; i < 3*ImportFlagWorkers; i++ {
+		objects = append(
+			objects,
+			&imgv1b1.ImageImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      fmt.Sprintf("myapp-%03d", i),
+					OwnerReferences: []metav1.OwnerReference{
+						{
+							Kind:       imgv1b1.ImageKind,
+							APIVersion: imgv1b1.GroupVersion,
+							Name:       img.Name,
+							UID:        img.UID,
+						},
+					},
+				},
+				Spec: imgv1b1.ImageImportSpec{
+					TargetImage: img.Name,
+					From:        img.Spec.From,
+				},
+				Status: imgv1b1.ImageImportStatus{
+					HashReference: &imgv1b1.HashReference{
+						From:       img.Spec.From,
+						ImportedAt: metav1.NewTime(time.Now().Add(time.Duration(i) * time.Second)),
+						ImageReference: fmt.Sprintf(
+							"quay.io/repo/myapp@sha256:%03d", i,
+						),
+					},
+				},
+			},
+		)
+	}
+
+	fakecli := corfake.NewSimpleClientset()
+	informer := coreinf.NewSharedInformerFactory(fakecli, time.Minute)
+
+	imgcli := imgfake.NewSimpleClientset(objects...)
+	imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+	svc := NewImage(informer, imgcli, imginf)
+
+	informer.Start(ctx.Done())
+	imginf.Start(ctx.Done())
+	if !cache.WaitForCacheSync(
+		ctx.Done(),
+		imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+		imginf.Tagger().V1beta1().ImageImports().Informer().HasSynced,
+	) {
+		t.Fatal("errors waiting for caches to sync")
+	}
+
+	if err := svc.Sync(ctx, img.DeepCopy()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	imports, err := imgcli.TaggerV1beta1().ImageImports("default").List(
+		ctx, metav1.ListOptions{},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error listing imports: %s", err)
+	}
+	for _, imp := range imports.Items {
+		if !imp.FlaggedAsConsumed() {
+			t.Errorf("import %s should have been flagged as consumed", imp.Name)
+		}
+	}
+}
+
+// Test_ImageSyncRequireApproval covers the approval gate: a finished import on an Image
+// requiring approval is held as pending, references only advance when approved.
+func Test_ImageSyncRequireApproval(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	img := &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "myapp",
+			UID:       "uid-myapp",
+		},
+		Spec: imgv1b1.ImageSpec{
+			From:            "quay.io/repo/myapp:latest",
+			RequireApproval: true,
+		},
+		Status: imgv1b1.ImageStatus{
+			HashReferences: []imgv1b1.HashReference{
+				{
+					ImportedAt:     metav1.NewTime(time.Now().Add(-time.Hour)),
+					ImageReference: "quay.io/repo/myapp@sha256:old",
+				},
+			},
+		},
+	}
+	imp := &imgv1b1.ImageImport{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "myapp-abc12345",
+			OwnerReferences: []metav1.OwnerReference{
+				{
+					Kind:       imgv1b1.ImageKind,
+					APIVersion: imgv1b1.GroupVersion,
+					Name:       img.Name,
+					UID:        img.UID,
+				},
+			},
+		},
+		Spec: imgv1b1.ImageImportSpec{
+			TargetImage: img.Name,
+			From:        img.Spec.From,
+		},
+		Status: imgv1b1.ImageImportStatus{
+			HashReference: &imgv1b1.HashReference{
+				From:           img.Spec.From,
+				ImportedAt:     metav1.NewTime(time.Now()),
+				ImageReference: "quay.io/repo/myapp@sha256:new",
+			},
+		},
+	}
+
+	fakecli := corfake.NewSimpleClientset()
+	informer := coreinf.NewSharedInformerFactory(fakecli, time.Minute)
+
+	imgcli := imgfake.NewSimpleClientset(img, imp)
+	imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+	svc := NewImage(informer, imgcli, imginf)
+
+	informer.Start(ctx.Done())
+	imginf.Start(ctx.Done())
+	if !cache.WaitForCacheSync(
+		ctx.Done(),
+		imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+		imginf.Tagger().V1beta1().ImageImports().Informer().HasSynced,
+	) {
+		t.Fatal("errors waiting for caches to sync")
+	}
+
+	if err := svc.Sync(ctx, img.DeepCopy()); err != nil {
+		t.Fatalf("unexpected sync error: %s", err)
+	}
+
+	// the import was resolved but held as pending, the active reference is untouched.
+	held, err := imgcli.TaggerV1beta1().Images("default").Get(
+		ctx, img.Name, metav1.GetOptions{},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error getting image: %s", err)
+	}
+	if ref := held.CurrentReferenceForImage(); ref != "quay.io/repo/myapp@sha256:old" {
+		t.Fatalf("active reference advanced without approval: %s", ref)
+	}
+	if held.Status.PendingReference == nil {
+		t.Fatal("expecting a pending reference, none found")
+	}
+	if ref := held.Status.PendingReference.ImageReference; ref != "quay.io/repo/myapp@sha256:new" {
+		t.Fatalf("wrong pending reference %s", ref)
+	}
+
+	// approving flips the pending reference into the active one.
+	approved, err := svc.Approve(ctx, "default", img.Name)
+	if err != nil {
+		t.Fatalf("unexpected error approving image: %s", err)
+	}
+	if ref := approved.CurrentReferenceForImage(); ref != "quay.io/repo/myapp@sha256:new" {
+		t.Errorf("approval did not advance the reference: %s", ref)
+	}
+	if approved.Status.PendingReference != nil {
+		t.Error("pending reference should have been cleared")
+	}
+
+	// a second approval has nothing to act on.
+	if _, err := svc.Approve(ctx, "default", img.Name); err == nil {
+		t.Error("expecting error approving image without pending reference")
+	}
+}
@@ -16,8 +16,14 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	stderrors "errors"
 	"fmt"
+	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -27,26 +33,58 @@ import (
 	"k8s.io/klog/v2"
 	"k8s.io/utils/pointer"
 
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 
 	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
 	imgclient "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
 	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
 	imglist "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/listers/images/v1beta1"
+	"github.com/ricardomaraschini/tagger/infra/imagestore"
 	"github.com/ricardomaraschini/tagger/infra/metrics"
 )
 
+var (
+	// DefaultImportTimeout is for how long we attempt to process an ImageImport when the
+	// user has not set spec.importTimeout.
+	DefaultImportTimeout = 5 * time.Minute
+	// MaxImportTimeout caps user provided import timeouts, operators may override this
+	// cap through the "maxImportTimeout" property in the operator ConfigMap.
+	MaxImportTimeout = time.Hour
+	// DefaultImportNameSuffixLength is how many random chars we append to the target
+	// image name when generating ImageImport names, overridable through the
+	// IMPORT_NAME_SUFFIX_LENGTH environment variable (capped at 32, a full uuid).
+	DefaultImportNameSuffixLength = 8
+)
+
+// maxGeneratedNameLength is the longest name we generate for an ImageImport object,
+// matching the limit kubernetes imposes on object names.
+const maxGeneratedNameLength = 253
+
+// ImporterVersion is stamped into every HashReference this operator records, the main
+// package sets it to the binary version at startup. Empty means the version is unknown
+// and the field is simply omitted from the status.
+var ImporterVersion = ""
+
 // ImageImport gather all actions related to image import objects.
 type ImageImport struct {
-	imgcli imgclient.Interface
-	imglis imglist.ImageLister
-	implis imglist.ImageImportLister
-	imginf imginform.SharedInformerFactory
-	syssvc *SysContext
+	imgcli   imgclient.Interface
+	imglis   imglist.ImageLister
+	implis   imglist.ImageImportLister
+	imginf   imginform.SharedInformerFactory
+	syssvc   *SysContext
+	resolver Resolver
+	sufflen  int
+	podname  string
+	nsmtx    sync.Mutex
+	nsseen   map[string]bool
 }
 
 // NewImageImport returns a handler for all Image import related services. I have chosen to go
@@ -65,15 +103,37 @@ func NewImageImport(
 		imglis = imginf.Tagger().V1beta1().Images().Lister()
 	}
 
+	sufflen := DefaultImportNameSuffixLength
+	if raw := os.Getenv("IMPORT_NAME_SUFFIX_LENGTH"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 32 {
+			klog.Warningf(
+				"invalid IMPORT_NAME_SUFFIX_LENGTH %q, using default", raw,
+			)
+		} else {
+			sufflen = parsed
+		}
+	}
+
 	return &ImageImport{
-		imginf: imginf,
-		imgcli: imgcli,
-		implis: implis,
-		imglis: imglis,
-		syssvc: NewSysContext(corinf),
+		imginf:   imginf,
+		imgcli:   imgcli,
+		implis:   implis,
+		imglis:   imglis,
+		syssvc:   NewSysContext(corinf),
+		resolver: defaultResolver{},
+		sufflen:  sufflen,
+		podname:  os.Getenv("POD_NAME"),
 	}
 }
 
+// SetResolver replaces the Resolver consulted during imports. The default resolver has
+// no opinion on any reference, leaving digests to be resolved directly against the
+// source registries.
+func (t *ImageImport) SetResolver(resolver Resolver) {
+	t.resolver = resolver
+}
+
 // ImportOpts holds the options necessary to call ImageImport.NewImport().
 type ImportOpts struct {
 	Namespace   string
@@ -87,12 +147,12 @@ type ImportOpts struct {
 // cluster. Returns the created object or an error.
 func (t *ImageImport) NewImport(ctx context.Context, o ImportOpts) (*imgv1b1.ImageImport, error) {
 	impid := strings.ReplaceAll(uuid.New().String(), "-", "")
-	impid = impid[0:8]
+	impid = impid[0:t.sufflen]
 
 	ii := &imgv1b1.ImageImport{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: o.Namespace,
-			Name:      fmt.Sprintf("%s-%s", o.TargetImage, impid),
+			Name:      importNameFor(o.TargetImage, impid),
 		},
 		Spec: imgv1b1.ImageImportSpec{
 			TargetImage: o.TargetImage,
@@ -107,6 +167,51 @@ func (t *ImageImport) NewImport(ctx context.Context, o ImportOpts) (*imgv1b1.Ima
 	)
 }
 
+// importNameFor assembles the name of a new ImageImport object targeting the provided
+// image. The target name is truncated when needed so the generated name, random suffix
+// included, never exceeds the kubernetes object name length limit. Trailing dots and
+// dashes left over by the truncation are dropped to keep the name valid.
+func importNameFor(target, suffix string) string {
+	maxtgt := maxGeneratedNameLength - len(suffix) - 1
+	if len(target) > maxtgt {
+		target = strings.TrimRight(target[:maxtgt], "-.")
+	}
+	return fmt.Sprintf("%s-%s", target, suffix)
+}
+
+// imageNameInvalidRegexp matches sequences of characters that can't be part of a
+// kubernetes object name.
+var imageNameInvalidRegexp = regexp.MustCompile(`[^a-z0-9-.]+`)
+
+// ImageNameForReference derives a valid kubernetes object name for an Image out of its
+// source reference. The registry domain is dropped while path separators and the tag
+// become part of the name with invalid characters replaced by dashes, quay.io/repo/app:v1
+// turns into repo-app-v1. Names too long for the kubernetes length limit are truncated
+// and suffixed with a short hash of the full reference so distinct sources do not collide
+// once truncated. Useful when creating Images in bulk, sparing callers from naming each
+// one individually.
+func ImageNameForReference(from string) string {
+	name := from
+	if named, err := reference.ParseNormalizedNamed(from); err == nil {
+		name = reference.Path(named)
+		if tagged, ok := named.(reference.Tagged); ok {
+			name = fmt.Sprintf("%s-%s", name, tagged.Tag())
+		}
+	}
+
+	name = strings.ToLower(name)
+	name = imageNameInvalidRegexp.ReplaceAllString(name, "-")
+	name = strings.Trim(name, "-.")
+
+	if len(name) > maxGeneratedNameLength {
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(from)))[:8]
+		maxlen := maxGeneratedNameLength - len(hash) - 1
+		name = strings.TrimRight(name[:maxlen], "-.")
+		name = fmt.Sprintf("%s-%s", name, hash)
+	}
+	return name
+}
+
 // NewImageFor creates a new Image object based on provided ImageImport. Embrace yourselves, from
 // now on I declare WAR on this source code! XXX it may be a good idea to merge ImageImport and
 // Image services into a single entity.
@@ -117,6 +222,7 @@ func (t *ImageImport) NewImageFor(
 		Namespace: ii.Namespace,
 		Name:      ii.Spec.TargetImage,
 		From:      ii.Spec.From,
+		Sources:   ii.Spec.Sources,
 		Mirror:    pointer.BoolDeref(ii.Spec.Mirror, false),
 		Insecure:  pointer.BoolDeref(ii.Spec.Insecure, false),
 	}
@@ -152,10 +258,64 @@ func (t *ImageImport) Delete(ctx context.Context, ii *imgv1b1.ImageImport) error
 	)
 }
 
+// ImportTimeoutFor returns for how long we should attempt to process provided ImageImport.
+// Users may tune this per object through spec.importTimeout, values above the cluster
+// configured maximum are silently capped. Absent or bogus values mean the default.
+func (t *ImageImport) ImportTimeoutFor(ii *imgv1b1.ImageImport) time.Duration {
+	timeout := DefaultImportTimeout
+	if custom, err := ii.ImportTimeoutDuration(); err == nil && custom > 0 {
+		timeout = custom
+	}
+
+	max := MaxImportTimeout
+	if raw, ok := t.syssvc.OperatorConfig()["maxImportTimeout"]; ok {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			max = parsed
+		}
+	}
+
+	if timeout > max {
+		timeout = max
+	}
+	return timeout
+}
+
+// registerDeadImport records provided ImageImport as a permanent failure in the target Image
+// status. ImageImports that gave up importing are flagged as consumed and eventually deleted,
+// keeping a capped record in the Image allows operators to inspect failures postmortem.
+func (t *ImageImport) registerDeadImport(ctx context.Context, ii *imgv1b1.ImageImport) error {
+	img, err := t.imgcli.TaggerV1beta1().Images(ii.Namespace).Get(
+		ctx, ii.Spec.TargetImage, metav1.GetOptions{},
+	)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to get target image: %w", err)
+	}
+
+	if _, err := updateImageStatus(
+		ctx, t.imgcli, img, func(img *imgv1b1.Image) {
+			img.PrependImportFailure(ii.PermanentFailure())
+		},
+	); err != nil {
+		return fmt.Errorf("unable to update target image status: %w", err)
+	}
+	return nil
+}
+
 // Sync manages image import change, assuring we have the image imported. Beware that we change
 // ImageImport in place before updating it on api server, i.e. use DeepCopy() before passing the
 // image import in.
 func (t *ImageImport) Sync(ctx context.Context, ii *imgv1b1.ImageImport) error {
+	if t.syssvc.Paused() {
+		klog.Warningf(
+			"reconciliation paused through operator config, skipping import %s/%s",
+			ii.Namespace, ii.Name,
+		)
+		return nil
+	}
+
 	if err := ii.Validate(); err != nil {
 		return fmt.Errorf("invalid image import: %w", err)
 	}
@@ -175,9 +335,22 @@ func (t *ImageImport) Sync(ctx context.Context, ii *imgv1b1.ImageImport) error {
 		return nil
 	}
 
+	// a streak of "manifest unknown" failures means the upstream tag is gone and no
+	// amount of retrying brings it back, give up ahead of the regular attempt limit
+	// to stop wasting registry calls. Users resume by creating a new import once the
+	// source exists again.
+	maxunknown := t.syssvc.MaxManifestUnknownFailures()
+	srcgone := maxunknown > 0 && ii.ConsecutiveManifestUnknownFailures() >= maxunknown
+	if srcgone {
+		klog.Infof(
+			"source manifest for import %s/%s unknown %d times in a row, giving up",
+			ii.Namespace, ii.Name, maxunknown,
+		)
+	}
+
 	// if no more attempts are going to be made on this ImageImport we can flag it for
 	// deletion. Deletion tends to take a while, check Delete() func for more on this.
-	if ii.FailedImportAttempts() >= imgv1b1.MaxImportAttempts {
+	if srcgone || ii.FailedImportAttempts() >= imgv1b1.MaxImportAttempts {
 		ii.FlagAsConsumed()
 		if _, err := t.imgcli.TaggerV1beta1().ImageImports(ii.Namespace).Update(
 			ctx, ii, metav1.UpdateOptions{},
@@ -188,6 +361,16 @@ func (t *ImageImport) Sync(ctx context.Context, ii *imgv1b1.ImageImport) error {
 			)
 		}
 
+		// keep a record of the permanent failure in the target Image status,
+		// the ImageImport object itself is going away soon.
+		if err := t.registerDeadImport(ctx, ii); err != nil {
+			klog.V(5).Infof(
+				"unable to register failure for import %s/%s: %s",
+				ii.Namespace, ii.Name, err,
+			)
+		}
+
+		go t.notifyImportOutcome(NotifyEventFailure, ii, ii.PermanentFailure().Reason)
 		klog.Infof("image import %s/%s has failed", ii.Namespace, ii.Name)
 		return nil
 	}
@@ -201,7 +384,15 @@ func (t *ImageImport) Sync(ctx context.Context, ii *imgv1b1.ImageImport) error {
 			return fmt.Errorf("unable to get target image: %w", err)
 		}
 
-		// We will create a new Image if none exist.
+		// We will create a new Image if none exist. Operators may opt out of this
+		// behavior, in which case imports pointing to a missing Image are errors.
+		if !t.syssvc.RecreateMissingImages() {
+			return fmt.Errorf(
+				"target image %s/%s does not exist",
+				ii.Namespace, ii.Spec.TargetImage,
+			)
+		}
+
 		if img, err = t.NewImageFor(ctx, ii); err != nil {
 			return fmt.Errorf("unable to create target image: %w", err)
 		}
@@ -229,37 +420,107 @@ func (t *ImageImport) Sync(ctx context.Context, ii *imgv1b1.ImageImport) error {
 	hashref, err := t.Import(ctx, ii)
 	if err != nil {
 		metrics.ImportFailures.Inc()
-		ii.RegisterImportFailure(err)
-		if _, nerr := t.imgcli.TaggerV1beta1().ImageImports(ii.Namespace).UpdateStatus(
-			ctx, ii, metav1.UpdateOptions{},
+		t.observeImportOutcome(ii.Namespace, false)
+		imperr := err
+		if _, nerr := updateImageImportStatus(
+			ctx, t.imgcli, ii, func(ii *imgv1b1.ImageImport) {
+				ii.RegisterImportFailure(imperr)
+			},
 		); nerr != nil {
 			klog.Errorf("error updating image import status: %s", nerr)
 		}
 		return fmt.Errorf("fail importing %s/%s: %w", ii.Namespace, ii.Name, err)
 	}
 
-	ii.RegisterImportSuccess()
-	ii.Status.HashReference = hashref
-	if _, err = t.imgcli.TaggerV1beta1().ImageImports(ii.Namespace).UpdateStatus(
-		ctx, ii, metav1.UpdateOptions{},
+	if _, err = updateImageImportStatus(
+		ctx, t.imgcli, ii, func(ii *imgv1b1.ImageImport) {
+			ii.RegisterImportSuccess()
+			ii.Status.HashReference = hashref
+		},
 	); err != nil {
 		return fmt.Errorf("error updating image import: %w", err)
 	}
 
 	metrics.ImportSuccesses.Inc()
+	t.observeImportOutcome(ii.Namespace, true)
+	go t.notifyImportOutcome(NotifyEventSuccess, ii, "")
 	klog.Infof("image import %s/%s processed.", ii.Namespace, ii.Name)
 	return nil
 }
 
+// namespaceMetricsOverflowLabel aggregates, in the per namespace import counters, all
+// namespaces beyond the configured cardinality cap.
+const namespaceMetricsOverflowLabel = "other"
+
+// observeImportOutcome bumps the namespace labeled import counters. These counters are
+// opt in, clusters hosting thousands of namespaces may not want the extra cardinality.
+func (t *ImageImport) observeImportOutcome(namespace string, succeeded bool) {
+	if !t.syssvc.NamespaceMetricsEnabled() {
+		return
+	}
+
+	label := t.namespaceMetricLabel(namespace)
+	if succeeded {
+		metrics.NamespaceImportSuccesses.WithLabelValues(label).Inc()
+		return
+	}
+	metrics.NamespaceImportFailures.WithLabelValues(label).Inc()
+}
+
+// namespaceMetricLabel returns the label value to be used for the provided namespace,
+// keeping track of how many distinct namespaces we have labeled so far. Once the cap
+// configured through namespaceMetricsLimit is reached new namespaces are aggregated
+// under the overflow label.
+func (t *ImageImport) namespaceMetricLabel(namespace string) string {
+	t.nsmtx.Lock()
+	defer t.nsmtx.Unlock()
+
+	if t.nsseen == nil {
+		t.nsseen = map[string]bool{}
+	}
+	if t.nsseen[namespace] {
+		return namespace
+	}
+
+	if len(t.nsseen) >= t.syssvc.NamespaceMetricsLimit() {
+		return namespaceMetricsOverflowLabel
+	}
+	t.nsseen[namespace] = true
+	return namespace
+}
+
 // Import runs an import on provided ImageImport. By Import here we mean to discover
-// what is the current hash for a given image in a given tag. We look for the image
-// in all configured unqualified registries using all authentications we can find
-// for the registry in the ImageImport namespace. If the image is set to be mirrored
-// we push the image to our mirror registry.
+// what is the current hash for a given image in a given tag. Sources configured in the
+// ImageImport are attempted in order, the first one from where we manage to import wins
+// and gets recorded in the returned HashReference.
 func (t *ImageImport) Import(
 	ctx context.Context, ii *imgv1b1.ImageImport,
 ) (*imgv1b1.HashReference, error) {
-	domain, remainder := t.splitRegistryDomain(ii.Spec.From)
+	var errors *multierror.Error
+	for _, from := range ii.SourcesToImport() {
+		hashref, err := t.importFrom(ctx, ii, from)
+		if err == nil {
+			return hashref, nil
+		}
+		errors = multierror.Append(errors, err)
+	}
+	return nil, fmt.Errorf("unable to import image: %w", errors)
+}
+
+// importFrom attempts to import provided source location on behalf of an ImageImport. We
+// look for the image in all configured unqualified registries using all authentications
+// we can find for the registry in the ImageImport namespace. If the image is set to be
+// mirrored we push the image to our mirror registry.
+func (t *ImageImport) importFrom(
+	ctx context.Context, ii *imgv1b1.ImageImport, from string,
+) (*imgv1b1.HashReference, error) {
+	domain, remainder := t.splitRegistryDomain(from)
+
+	// references without an explicit tag or digest default to a configurable tag,
+	// ":latest" unless the namespace or the cluster says otherwise.
+	if !imgv1b1.TaggedReference(remainder) {
+		remainder = fmt.Sprintf("%s:%s", remainder, t.syssvc.DefaultTagFor(ii.Namespace))
+	}
 
 	registries, err := t.syssvc.RegistriesToSearch(ctx, domain)
 	if err != nil {
@@ -271,32 +532,153 @@ func (t *ImageImport) Import(
 		imgpath := fmt.Sprintf("docker://%s/%s", registry, remainder)
 		imgref, err := alltransports.ParseImageName(imgpath)
 		if err != nil {
-			errors = multierror.Append(errors, err)
+			errors = multierror.Append(errors, t.registryError(registry, err))
 			continue
 		}
 
 		insecure := pointer.BoolDeref(ii.Spec.Insecure, false)
 		sysctxs, err := t.syssvc.SystemContextsFor(ctx, imgref, ii.Namespace, insecure)
 		if err != nil {
-			errors = multierror.Append(errors, err)
+			errors = multierror.Append(errors, t.registryError(registry, err))
 			continue
 		}
 
-		imghash, sysctx, err := t.HashReferenceByImage(ctx, imgref, sysctxs)
+		// the configured resolver may override which reference gets imported. The
+		// override still goes through the regular probing below so policy checks
+		// run and working credentials are discovered for it.
+		lookupref := imgref
+		if t.resolver != nil {
+			resolved, err := t.resolver.Resolve(ctx, imgref, ii.Namespace)
+			if err != nil {
+				errors = multierror.Append(
+					errors, t.registryError(registry, err),
+				)
+				continue
+			}
+			if resolved != nil {
+				lookupref = resolved
+			}
+		}
+
+		imghash, sysctx, created, lbls, err := t.HashReferenceByImage(
+			ctx, lookupref, sysctxs, ii.Spec.Platform, t.maxSizeBytesFor(ii),
+		)
 		if err != nil {
-			errors = multierror.Append(errors, err)
+			t.syssvc.RecordRegistryOutcome(registry, false)
+			errors = multierror.Append(errors, t.registryError(registry, err))
 			continue
 		}
+		t.syssvc.RecordRegistryOutcome(registry, true)
+
+		// when enabled we try, on a best effort basis, to discover which immutable
+		// tag in the source repository points to the digest we have just resolved.
+		// This has to happen before mirroring as manifest conversions during the
+		// copy may change the digest.
+		var resolvedtag string
+		if t.syssvc.ResolveFloatingTags() {
+			resolvedtag = t.resolveImmutableTag(ctx, imgref, imghash, sysctx)
+		}
 
-		if mirror := pointer.BoolDeref(ii.Spec.Mirror, false); mirror {
-			istore, err := t.syssvc.GetRegistryStore(ctx)
+		// images served by registries listed in the mirrorSkipRegistries config are
+		// not copied into the mirror even when mirroring is requested, they already
+		// live somewhere we consider local so we record the upstream reference.
+		mirror := pointer.BoolDeref(ii.Spec.Mirror, false)
+		if mirror && domainMatchesAny(registry, t.syssvc.MirrorSkipRegistries()) {
+			klog.Infof(
+				"registry %s listed in mirrorSkipRegistries, skipping mirror",
+				registry,
+			)
+			mirror = false
+		}
+
+		// an import whose source is its own repository inside the mirror registry
+		// would copy the image onto itself, a pointless and confusing operation.
+		// We record the source reference directly instead, or reject the import
+		// altogether when the operator is configured to do so.
+		if mirror {
+			regaddr, _, err := t.syssvc.MirrorRegistryAddresses()
+			if err == nil && mirrorLoops(
+				regaddr, registry, remainder, ii.Namespace, ii.Spec.TargetImage,
+			) {
+				if t.syssvc.RejectMirrorLoops() {
+					return nil, fmt.Errorf(
+						"source of import %s/%s is its own mirror "+
+							"repository, refusing to copy the image "+
+							"onto itself",
+						ii.Namespace, ii.Name,
+					)
+				}
+				klog.Infof(
+					"source of import %s/%s is its own mirror repository, "+
+						"skipping mirror",
+					ii.Namespace, ii.Name,
+				)
+				mirror = false
+			}
+		}
+
+		if mirror {
+			// if the digest we have just resolved upstream matches the digest of
+			// the last mirrored reference there is nothing new to copy, reuse
+			// the mirror reference we already have and spare the mirror from a
+			// pointless write. Manifest conversions change the digest during the
+			// copy so in that case we can't take the shortcut.
+			prevref := t.currentMirrorReference(ii)
+			if ii.Spec.MirrorManifestType == "" && matchesDigest(prevref, imghash) {
+				klog.Infof(
+					"image %s unchanged upstream, skipping mirror load",
+					from,
+				)
+				return &imgv1b1.HashReference{
+					From:            fmt.Sprintf("%s/%s", registry, remainder),
+					ImportedAt:      metav1.NewTime(time.Now()),
+					CreatedAt:       created,
+					ResolvedTag:     resolvedtag,
+					ImageReference:  prevref,
+					ImportedBy:      t.podname,
+					ImporterVersion: ImporterVersion,
+					Labels:          lbls,
+				}, nil
+			}
+
+			istore, err := t.syssvc.GetRegistryStore(ctx, ii.Namespace)
 			if err != nil {
 				return nil, fmt.Errorf("unable to get image store: %w", err)
 			}
 
+			// when no manifest conversion is requested digests are preserved by
+			// the copy, so we can ask the store to skip loading digests the
+			// mirror already hosts.
+			loadopts := []imagestore.LoadOption{imagestore.WithSkipIfPresent()}
+			if ii.Spec.MirrorManifestType != "" {
+				loadopts = []imagestore.LoadOption{
+					imagestore.WithForcedManifestType(ii.Spec.MirrorManifestType),
+				}
+			}
+			if len(ii.Spec.MirrorArchitectures) > 0 {
+				loadopts = append(
+					loadopts,
+					imagestore.WithMirrorArchitectures(
+						ii.Spec.MirrorArchitectures,
+					),
+				)
+			}
+
+			// freshly pushed multi arch images may have their manifest list
+			// visible before all child manifests are, give those a few extra
+			// attempts instead of failing the whole import.
+			loadopts = append(
+				loadopts,
+				imagestore.WithChildManifestRetries(
+					imagestore.DefaultChildManifestRetries,
+				),
+			)
+
 			start := time.Now()
 			timg := ii.Spec.TargetImage
-			imghash, err = istore.Load(ctx, imghash, sysctx, ii.Namespace, timg)
+			imghash, err = istore.Load(
+				ctx, imghash, sysctx, ii.Namespace, timg, loadopts...,
+			)
 			if err != nil {
 				return nil, fmt.Errorf("fail to mirror image: %w", err)
 			}
@@ -305,19 +687,272 @@ func (t *ImageImport) Import(
 			metrics.MirrorLatency.Observe(latency)
 		}
 
+		imgrefstr := imghash.DockerReference().String()
+		if t.syssvc.NormalizeReferences() {
+			imgrefstr = familiarReference(imgrefstr)
+		}
+
+		// we record in the HashReference the fully qualified source, i.e. prefixed
+		// with the registry that satisfied this import. When the "from" is an
+		// unqualified reference this tells users which of the configured registries
+		// actually served the image.
 		return &imgv1b1.HashReference{
-			From:           ii.Spec.From,
-			ImportedAt:     metav1.NewTime(time.Now()),
-			ImageReference: imghash.DockerReference().String(),
+			From:            fmt.Sprintf("%s/%s", registry, remainder),
+			ImportedAt:      metav1.NewTime(time.Now()),
+			CreatedAt:       created,
+			ResolvedTag:     resolvedtag,
+			ImageReference:  imgrefstr,
+			ImportedBy:      t.podname,
+			ImporterVersion: ImporterVersion,
+			Labels:          lbls,
 		}, nil
 	}
 
-	return nil, fmt.Errorf("unable to import image: %w", errors)
+	return nil, fmt.Errorf("unable to import from %s: %w", from, errors)
+}
+
+// mirrorLoops returns true when an import served by the provided registry would mirror
+// the image onto the very repository it came from. Remainder is the source reference
+// without its registry domain, ns and name identify the destination repository inside
+// the mirror. Both mirror layouts are covered, "<ns>/<name>" and the single repository
+// one where images are stored under "<repo>/<ns>-<name>".
+func mirrorLoops(regaddr, registry, remainder, ns, name string) bool {
+	if registry != regaddr {
+		return false
+	}
+
+	repo := remainder
+	if idx := strings.Index(repo, "@"); idx >= 0 {
+		repo = repo[:idx]
+	}
+	if idx := strings.LastIndex(repo, ":"); idx >= 0 {
+		repo = repo[:idx]
+	}
+
+	if repo == fmt.Sprintf("%s/%s", ns, name) {
+		return true
+	}
+	return strings.HasSuffix(repo, fmt.Sprintf("/%s-%s", ns, name))
+}
+
+// domainMatchesAny returns true when the provided registry domain matches one of the
+// provided patterns. A pattern is either an exact domain (ports included) or a "*."
+// prefixed suffix matching any subdomain, e.g. "*.corp.example" matches both
+// "registry.corp.example" and "cache.registry.corp.example".
+func domainMatchesAny(domain string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if pattern == domain {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") &&
+			strings.HasSuffix(domain, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxResolvedTagProbes caps how many tags we are willing to inspect while cross referencing
+// a floating tag with its immutable counterpart, repositories may host thousands of tags.
+var maxResolvedTagProbes = 50
+
+// resolveImmutableTag attempts to discover which other tag in the source repository points
+// to the digest we have just resolved, so history can show a floating tag moving through
+// immutable releases. This is a best effort operation, any failure simply yields an empty
+// string and the import carries on.
+func (t *ImageImport) resolveImmutableTag(
+	ctx context.Context, imgref, imghash types.ImageReference, sysctx *types.SystemContext,
+) string {
+	canonical, ok := imghash.DockerReference().(reference.Canonical)
+	if !ok {
+		return ""
+	}
+
+	var srctag string
+	if tagged, ok := imgref.DockerReference().(reference.Tagged); ok {
+		srctag = tagged.Tag()
+	}
+
+	tags, err := docker.GetRepositoryTags(ctx, sysctx, imgref)
+	if err != nil {
+		klog.V(5).Infof("unable to list tags for %s: %s", imgref.DockerReference(), err)
+		return ""
+	}
+
+	var probes int
+	for _, tag := range tags {
+		if tag == srctag {
+			continue
+		}
+		if probes >= maxResolvedTagProbes {
+			break
+		}
+		probes++
+
+		tagref, err := reference.WithTag(
+			reference.TrimNamed(imgref.DockerReference()), tag,
+		)
+		if err != nil {
+			continue
+		}
+
+		proberef, err := docker.NewReference(tagref)
+		if err != nil {
+			continue
+		}
+
+		dgst, err := manifestDigestFor(ctx, proberef, sysctx, canonical.Digest().Algorithm())
+		if err != nil {
+			klog.V(5).Infof("unable to probe tag %s: %s", tag, err)
+			continue
+		}
+
+		if dgst == canonical.Digest() {
+			return tag
+		}
+	}
+	return ""
+}
+
+// manifestDigestFor fetches the manifest for the provided image reference and returns its
+// digest, computed with the provided algorithm so results are comparable with references
+// composed elsewhere in the import flow.
+func manifestDigestFor(
+	ctx context.Context,
+	imgref types.ImageReference,
+	sysctx *types.SystemContext,
+	algo digest.Algorithm,
+) (digest.Digest, error) {
+	src, err := imgref.NewImageSource(ctx, sysctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to access image: %w", err)
+	}
+	defer src.Close()
+
+	manblob, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch manifest: %w", err)
+	}
+	return digestForManifest(manblob, algo)
+}
+
+// digestForManifest computes the digest of the provided manifest blob using the given
+// algorithm. Signed docker schema 1 manifests are always digested through the canonical
+// path as their signatures must be stripped before hashing.
+func digestForManifest(manblob []byte, algo digest.Algorithm) (digest.Digest, error) {
+	if algo == digest.Canonical ||
+		manifest.GuessMIMEType(manblob) == manifest.DockerV2Schema1SignedMediaType {
+		return manifest.Digest(manblob)
+	}
+	return algo.FromBytes(manblob), nil
+}
+
+// currentMirrorReference returns the mirror hosted image reference pointed by the most
+// recent import in the ImageImport's target Image. Returns an empty string if the target
+// Image can't be found, has no imports catalogued yet or its most recent reference does
+// not live in our mirror registry (e.g. it was recorded while mirroring was disabled),
+// reusing such a reference would skip a copy that never happened.
+func (t *ImageImport) currentMirrorReference(ii *imgv1b1.ImageImport) string {
+	if t.imglis == nil {
+		return ""
+	}
+
+	img, err := t.imglis.Images(ii.Namespace).Get(ii.Spec.TargetImage)
+	if err != nil {
+		return ""
+	}
+
+	ref := img.CurrentReferenceForImage()
+	if ref == "" {
+		return ""
+	}
+
+	regaddr, _, err := t.syssvc.MirrorRegistryAddresses()
+	if err != nil {
+		return ""
+	}
+	if domain, _ := splitRegistryDomain(ref); domain != regaddr {
+		return ""
+	}
+	return ref
+}
+
+// matchesDigest compares the digest portion of provided image reference (a string in the
+// "repo/img@sha256:..." format) with the digest portion of provided ImageReference. Returns
+// false whenever one of the digests can't be extracted.
+func matchesDigest(ref string, imghash types.ImageReference) bool {
+	slices := strings.SplitN(ref, "@", 2)
+	if len(slices) != 2 {
+		return false
+	}
+
+	hslices := strings.SplitN(imghash.DockerReference().String(), "@", 2)
+	if len(hslices) != 2 {
+		return false
+	}
+	return slices[1] == hslices[1]
+}
+
+// registryError wraps an error that happened while attempting an import from a given registry.
+// The returned error is prefixed with the registry name and a coarse classification (auth,
+// not found or network) so that when errors for multiple registries are aggregated users can
+// tell "not found anywhere" apart from "auth failed everywhere".
+func (t *ImageImport) registryError(registry string, err error) error {
+	return fmt.Errorf("registry %s: %s: %w", registry, classifyRegistryError(err), err)
+}
+
+// classifyRegistryError inspects an error reported while talking to a registry and sorts it
+// into one of a few coarse buckets. We have no access to structured errors at this point
+// (containers/image wraps them in plain strings by the time they get here) so we resort to
+// matching on the error message.
+func classifyRegistryError(err error) string {
+	// rejected credentials are reported through a dedicated type by the docker
+	// transport, match it structurally before falling back to message matching.
+	var badcreds docker.ErrUnauthorizedForCredentials
+	if stderrors.As(err, &badcreds) {
+		return "authentication error"
+	}
+
+	msg := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(msg, "unauthorized") ||
+		strings.Contains(msg, "authentication required") ||
+		strings.Contains(msg, "invalid username/password"):
+		return "authentication error"
+	// registries such as docker.io require fetching a bearer token from an auth
+	// endpoint before serving manifests, failures in that handshake are neither a
+	// missing image nor an unreachable registry so they get their own bucket. This
+	// case runs before the network one on purpose, a timeout while fetching the
+	// token would otherwise be filed as a plain network error.
+	case strings.Contains(msg, "auth token") ||
+		strings.Contains(msg, "fetching token") ||
+		strings.Contains(msg, "token endpoint"):
+		return "token endpoint error"
+	case strings.Contains(msg, "manifest unknown") ||
+		strings.Contains(msg, "name unknown") ||
+		strings.Contains(msg, "not found"):
+		return "image not found"
+	case strings.Contains(msg, "no such host") ||
+		strings.Contains(msg, "connection refused") ||
+		strings.Contains(msg, "timeout") ||
+		strings.Contains(msg, "timed out") ||
+		strings.Contains(msg, "pinging container registry"):
+		return "network error"
+	default:
+		return "unclassified error"
+	}
 }
 
 // splitRegistryDomain splits the domain from the repository and image.  For example passing in
 // the "quay.io/tagger/tagger:latest" string will result in "quay.io" and "tagger/tagger:latest".
 func (t *ImageImport) splitRegistryDomain(imgPath string) (string, string) {
+	return splitRegistryDomain(imgPath)
+}
+
+// splitRegistryDomain splits the domain from the repository and image, see the method of
+// the same name on ImageImport. Kept as a package function so other entities in this
+// package can evaluate source references as the import would.
+func splitRegistryDomain(imgPath string) (string, string) {
 	imageSlices := strings.SplitN(imgPath, "/", 2)
 	if len(imageSlices) < 2 {
 		return "", imgPath
@@ -342,6 +977,85 @@ func (t *ImageImport) Get(ctx context.Context, ns, name string) (*imgv1b1.ImageI
 	return imp.DeepCopy(), nil
 }
 
+// familiarReference rewrites provided image reference using its short, familiar form, e.g.
+// docker.io/library/centos@sha256:... becomes centos@sha256:... References that can't be
+// parsed are returned untouched.
+func familiarReference(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	return reference.FamiliarString(named)
+}
+
+// choosePlatformInstance returns the digest of the manifest matching provided platform (an
+// "os/arch" or "os/arch/variant" string) inside a manifest list blob. The platform string
+// is validated here as well, objects created while the admission webhook was absent or
+// ignoring failures reach the sync path unchecked.
+func choosePlatformInstance(manblob []byte, mtype, platform string) (digest.Digest, error) {
+	if err := validatePlatform(platform); err != nil {
+		return "", err
+	}
+
+	list, err := manifest.ListFromBlob(manblob, mtype)
+	if err != nil {
+		return "", fmt.Errorf("error parsing manifest list: %w", err)
+	}
+
+	slices := strings.SplitN(platform, "/", 3)
+	sysctx := &types.SystemContext{
+		OSChoice:           slices[0],
+		ArchitectureChoice: slices[1],
+	}
+	if len(slices) == 3 {
+		sysctx.VariantChoice = slices[2]
+	}
+
+	dgst, err := list.ChooseInstance(sysctx)
+	if err != nil {
+		return "", fmt.Errorf("no manifest for platform %s: %w", platform, err)
+	}
+	return dgst, nil
+}
+
+// validatePlatform checks provided platform string is in the "os/arch" or "os/arch/variant"
+// format. An empty platform is valid and means "record whatever digest the source reports".
+func validatePlatform(platform string) error {
+	if platform == "" {
+		return nil
+	}
+
+	slices := strings.Split(platform, "/")
+	if len(slices) < 2 || len(slices) > 3 {
+		return fmt.Errorf("invalid platform %q, expected os/arch or os/arch/variant", platform)
+	}
+	for _, slice := range slices {
+		if slice == "" {
+			return fmt.Errorf("invalid platform %q, empty component", platform)
+		}
+	}
+	return nil
+}
+
+// validateManifestType checks a manifest media type provided by the user refers to a media
+// type we know about. An empty media type is valid and means "preserve the source type".
+func validateManifestType(mtype string) error {
+	if mtype == "" {
+		return nil
+	}
+	for _, valid := range []string{
+		imgspecv1.MediaTypeImageManifest,
+		imgspecv1.MediaTypeImageIndex,
+		manifest.DockerV2Schema2MediaType,
+		manifest.DockerV2ListMediaType,
+	} {
+		if mtype == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown manifest media type %q", mtype)
+}
+
 // Validate checks if provided ImageImport contain all mandatory fields. If ImageImport does
 // contains an empty "spec.from" we attempt to load the targetImage.
 func (t *ImageImport) Validate(ctx context.Context, imp *imgv1b1.ImageImport) error {
@@ -349,11 +1063,28 @@ func (t *ImageImport) Validate(ctx context.Context, imp *imgv1b1.ImageImport) er
 		return err
 	}
 
+	if err := validateManifestType(imp.Spec.MirrorManifestType); err != nil {
+		return err
+	}
+
+	if err := validatePlatform(imp.Spec.Platform); err != nil {
+		return err
+	}
+
+	for _, from := range append([]string{imp.Spec.From}, imp.Spec.Sources...) {
+		if from == "" {
+			continue
+		}
+		if err := t.syssvc.ValidateSourceRegistry(ctx, from); err != nil {
+			return err
+		}
+	}
+
 	if _, err := t.imglis.Images(imp.Namespace).Get(imp.Spec.TargetImage); err != nil {
 		if !errors.IsNotFound(err) {
 			return err
-		} else if imp.Spec.From == "" {
-			return fmt.Errorf("empty spec.from")
+		} else if imp.Spec.From == "" && len(imp.Spec.Sources) == 0 {
+			return fmt.Errorf("empty spec.from and spec.sources")
 		}
 	}
 	return nil
@@ -368,54 +1099,244 @@ func (t *ImageImport) AddEventHandler(handler cache.ResourceEventHandler) {
 // It receives an image reference pointing to an image by its tag (reg.io/repo/img:tag)
 // and returns a image reference by hash (reg.io/repo/img@sha256:abc...). It runs through
 // provided system contexts trying all of them. If no SystemContext is present it does one
-// attempt without authentication. Returns the image reference and the SystemContext that
-// worked or an error.
+// attempt without authentication. Returns the image reference, the SystemContext that
+// worked and the image build timestamp (nil unless the operator is configured to fetch
+// it) or an error. Contexts are probed one at a time unless the operator opted in for
+// parallel probing, see SysContext.CredentialProbeParallelism.
 func (t *ImageImport) HashReferenceByImage(
-	ctx context.Context, imgref types.ImageReference, sysctxs []*types.SystemContext,
-) (types.ImageReference, *types.SystemContext, error) {
+	ctx context.Context,
+	imgref types.ImageReference,
+	sysctxs []*types.SystemContext,
+	platform string,
+	maxSize int64,
+) (types.ImageReference, *types.SystemContext, *metav1.Time, map[string]string, error) {
 	// if no contexts then we do an attempt without using any credentials.
 	if len(sysctxs) == 0 {
 		sysctxs = []*types.SystemContext{nil}
 	}
 
+	if parallelism := t.syssvc.CredentialProbeParallelism(); parallelism > 1 {
+		return t.parallelHashReferenceByImage(
+			ctx, imgref, sysctxs, platform, maxSize, parallelism,
+		)
+	}
+
 	var errors *multierror.Error
 	for _, sysctx := range sysctxs {
-		imghash, err := t.getImageHash(ctx, imgref, sysctx)
+		imghash, created, lbls, err := t.getImageHash(
+			ctx, imgref, sysctx, platform, maxSize,
+		)
 		if err == nil {
-			return imghash, sysctx, nil
+			return imghash, sysctx, created, lbls, nil
 		}
 		errors = multierror.Append(errors, err)
 	}
-	return nil, nil, fmt.Errorf("unable to get hash for image image: %w", errors)
+	return nil, nil, nil, nil, fmt.Errorf("unable to get hash for image image: %w", errors)
+}
+
+// hashProbeResult carries the outcome of a single credential probe ran by
+// parallelHashReferenceByImage.
+type hashProbeResult struct {
+	imghash types.ImageReference
+	sysctx  *types.SystemContext
+	created *metav1.Time
+	labels  map[string]string
+	err     error
+}
+
+// parallelHashReferenceByImage probes provided system contexts with bounded parallelism,
+// up to parallelism attempts run at once. The first successful probe wins, the remaining
+// ones are cancelled. This speeds up digest resolution in namespaces hosting many secrets
+// for the same registry, at the cost of hitting the registry with concurrent (and mostly
+// wrong) credentials.
+func (t *ImageImport) parallelHashReferenceByImage(
+	ctx context.Context,
+	imgref types.ImageReference,
+	sysctxs []*types.SystemContext,
+	platform string,
+	maxSize int64,
+	parallelism int,
+) (types.ImageReference, *types.SystemContext, *metav1.Time, map[string]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tokens := make(chan struct{}, parallelism)
+	results := make(chan hashProbeResult, len(sysctxs))
+	for _, sysctx := range sysctxs {
+		go func(sysctx *types.SystemContext) {
+			select {
+			case tokens <- struct{}{}:
+				defer func() { <-tokens }()
+			case <-ctx.Done():
+				results <- hashProbeResult{err: ctx.Err()}
+				return
+			}
+
+			imghash, created, lbls, err := t.getImageHash(
+				ctx, imgref, sysctx, platform, maxSize,
+			)
+			results <- hashProbeResult{
+				imghash: imghash,
+				sysctx:  sysctx,
+				created: created,
+				labels:  lbls,
+				err:     err,
+			}
+		}(sysctx)
+	}
+
+	var errors *multierror.Error
+	for range sysctxs {
+		res := <-results
+		if res.err == nil {
+			return res.imghash, res.sysctx, res.created, res.labels, nil
+		}
+		errors = multierror.Append(errors, res.err)
+	}
+	return nil, nil, nil, nil, fmt.Errorf("unable to get hash for image image: %w", errors)
+}
+
+// maxSizeBytesFor returns the maximum image size, in bytes, tolerated when importing the
+// provided ImageImport. Users may set this per object through spec.maxSizeBytes, when they
+// don't we read the cluster default from the operator ConfigMap ("maxSizeBytes" property).
+// Zero means unlimited.
+func (t *ImageImport) maxSizeBytesFor(ii *imgv1b1.ImageImport) int64 {
+	if ii.Spec.MaxSizeBytes > 0 {
+		return ii.Spec.MaxSizeBytes
+	}
+
+	raw, ok := t.syssvc.OperatorConfig()["maxSizeBytes"]
+	if !ok {
+		return 0
+	}
+	parsed, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || parsed < 0 {
+		klog.Warningf("invalid maxSizeBytes %q in operator config, ignoring", raw)
+		return 0
+	}
+	return parsed
+}
+
+// checkImageSize verifies the image whose manifest is provided does not exceed maxSize bytes,
+// summing config and layer sizes as reported by the manifest. A maxSize of zero means no
+// limit. Manifest lists are not checked, their total size is not known without fetching
+// every child manifest.
+func checkImageSize(manifestBlob []byte, mtype string, maxSize int64) error {
+	if maxSize <= 0 || manifest.MIMETypeIsMultiImage(mtype) {
+		return nil
+	}
+
+	man, err := manifest.FromBlob(manifestBlob, mtype)
+	if err != nil {
+		return fmt.Errorf("unable to parse image manifest: %w", err)
+	}
+
+	total := man.ConfigInfo().Size
+	for _, layer := range man.LayerInfos() {
+		total += layer.Size
+	}
+	if total > maxSize {
+		return fmt.Errorf(
+			"image size of %d bytes exceeds the configured limit of %d bytes",
+			total, maxSize,
+		)
+	}
+	return nil
+}
+
+// allowedManifestType checks provided manifest media type against the cluster configured
+// allowlist, the comma separated "allowedManifestTypes" property in the operator ConfigMap.
+// An empty allowlist means all media types are accepted. This is a guardrail for clusters
+// that only want to mirror runnable images, rejecting unexpected artifact types.
+func (t *ImageImport) allowedManifestType(mtype string) error {
+	raw := t.syssvc.OperatorConfig()["allowedManifestTypes"]
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+
+	for _, allowed := range strings.Split(raw, ",") {
+		if strings.TrimSpace(allowed) == mtype {
+			return nil
+		}
+	}
+	return fmt.Errorf("manifest media type %q not allowed", mtype)
 }
 
 // getImageHash attempts to fetch image hash remotely using provided system context. Hash is
 // full image path with its hash, something like reg.io/repo/img@sha256:... The ideia here is
 // that the "from" reference points to a image by tag, something like reg.io/repo/img:latest
-// and we return a reference by hash (something like reg.io/repo/img@sha256:...).
+// and we return a reference by hash (something like reg.io/repo/img@sha256:...). A non empty
+// platform makes us resolve the digest of the matching platform specific manifest instead
+// of the manifest list digest. When the operator is configured to fetch created timestamps
+// or to capture labels we also download the image config blob and return the "created"
+// property and the selected labels found in it.
 func (t *ImageImport) getImageHash(
-	ctx context.Context, from types.ImageReference, sysctx *types.SystemContext,
-) (types.ImageReference, error) {
+	ctx context.Context,
+	from types.ImageReference,
+	sysctx *types.SystemContext,
+	platform string,
+	maxSize int64,
+) (types.ImageReference, *metav1.Time, map[string]string, error) {
 	img, err := from.NewImage(ctx, sysctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create image closer: %w", err)
+		return nil, nil, nil, fmt.Errorf("unable to create image closer: %w", err)
 	}
 	defer img.Close()
 
-	manifestBlob, _, err := img.Manifest(ctx)
+	manifestBlob, mtype, err := img.Manifest(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to fetch image manifest: %w", err)
+		return nil, nil, nil, fmt.Errorf("unable to fetch image manifest: %w", err)
+	}
+
+	if err := t.allowedManifestType(mtype); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := checkImageSize(manifestBlob, mtype, maxSize); err != nil {
+		return nil, nil, nil, err
 	}
 
-	dgst, err := manifest.Digest(manifestBlob)
+	dgst, err := digestForManifest(manifestBlob, t.syssvc.ManifestDigestAlgorithm())
 	if err != nil {
-		return nil, fmt.Errorf("error calculating manifest digest: %w", err)
+		return nil, nil, nil, fmt.Errorf("error calculating manifest digest: %w", err)
+	}
+
+	if platform != "" && manifest.MIMETypeIsMultiImage(mtype) {
+		if dgst, err = choosePlatformInstance(manifestBlob, mtype, platform); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// the config blob costs us one extra round trip to the registry hence it is only
+	// fetched when the cluster opts in. Failures here do not abort the import, the
+	// build timestamp and the labels are informational.
+	var created *metav1.Time
+	var lbls map[string]string
+	capture := t.syssvc.CaptureLabels()
+	if t.syssvc.FetchCreatedTimestamps() || len(capture) > 0 {
+		if conf, err := img.OCIConfig(ctx); err != nil {
+			klog.Warningf("unable to fetch image config blob: %s", err)
+		} else {
+			if t.syssvc.FetchCreatedTimestamps() && conf.Created != nil {
+				created = &metav1.Time{Time: *conf.Created}
+			}
+			for _, key := range capture {
+				val, ok := conf.Config.Labels[key]
+				if !ok {
+					continue
+				}
+				if lbls == nil {
+					lbls = map[string]string{}
+				}
+				lbls[key] = val
+			}
+		}
 	}
 
 	refstr := fmt.Sprintf("docker://%s@%s", from.DockerReference().Name(), dgst)
 	hashref, err := alltransports.ParseImageName(refstr)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	return hashref, nil
+	return hashref, created, lbls, nil
 }
@@ -22,12 +22,16 @@ import (
 	"testing"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	coreinf "k8s.io/client-go/informers"
 	corfake "k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/transports/alltransports"
+
 	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
 	imgfake "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned/fake"
 	imginf "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
@@ -338,6 +342,130 @@ func Test_splitRegistryDomain(t *testing.T) {
 	}
 }
 
+func Test_matchesDigest(t *testing.T) {
+	dgst := "sha256:14dc2a417a4cb5894b58d6933ffad42783e2a2f416e142ba20c6e5ebb9bed443"
+	for _, tt := range []struct {
+		name    string
+		ref     string
+		imgref  string
+		matches bool
+	}{
+		{
+			name:    "same digest",
+			ref:     fmt.Sprintf("mirror.io/ns/img@%s", dgst),
+			imgref:  fmt.Sprintf("docker://docker.io/library/centos@%s", dgst),
+			matches: true,
+		},
+		{
+			name:    "different digests",
+			ref:     "mirror.io/ns/img@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			imgref:  fmt.Sprintf("docker://docker.io/library/centos@%s", dgst),
+			matches: false,
+		},
+		{
+			name:    "no previous reference",
+			ref:     "",
+			imgref:  fmt.Sprintf("docker://docker.io/library/centos@%s", dgst),
+			matches: false,
+		},
+		{
+			name:    "previous reference by tag",
+			ref:     "mirror.io/ns/img:latest",
+			imgref:  fmt.Sprintf("docker://docker.io/library/centos@%s", dgst),
+			matches: false,
+		},
+		{
+			name:    "resolved reference by tag",
+			ref:     fmt.Sprintf("mirror.io/ns/img@%s", dgst),
+			imgref:  "docker://docker.io/library/centos:latest",
+			matches: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			imghash, err := alltransports.ParseImageName(tt.imgref)
+			if err != nil {
+				t.Fatalf("error parsing image reference: %s", err)
+			}
+
+			if matches := matchesDigest(tt.ref, imghash); matches != tt.matches {
+				t.Errorf("expecting matches to be %v, %v received", tt.matches, matches)
+			}
+		})
+	}
+}
+
+func Test_classifyRegistryError(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		err   string
+		class string
+	}{
+		{
+			name:  "authentication failure",
+			err:   "unable to retrieve auth token: invalid username/password",
+			class: "authentication error",
+		},
+		{
+			name:  "unauthorized access",
+			err:   "reading manifest: unauthorized: access to the resource is denied",
+			class: "authentication error",
+		},
+		{
+			name:  "missing manifest",
+			err:   "reading manifest latest: manifest unknown",
+			class: "image not found",
+		},
+		{
+			name:  "unknown repository",
+			err:   "name unknown: repository name not known to registry",
+			class: "image not found",
+		},
+		{
+			name:  "dns failure",
+			err:   "dial tcp: lookup reg.io: no such host",
+			class: "network error",
+		},
+		{
+			name:  "registry offline",
+			err:   "pinging container registry reg.io: connection refused",
+			class: "network error",
+		},
+		{
+			name:  "token endpoint unreachable",
+			err:   "unable to retrieve auth token: Get \"https://auth.docker.io/token\": dial tcp: i/o timeout",
+			class: "token endpoint error",
+		},
+		{
+			name:  "token endpoint misbehaving",
+			err:   "error fetching token: unexpected status code 503",
+			class: "token endpoint error",
+		},
+		{
+			name:  "anything else",
+			err:   "some very weird error",
+			class: "unclassified error",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			class := classifyRegistryError(fmt.Errorf(tt.err))
+			if class != tt.class {
+				t.Errorf("expecting class %q, received %q", tt.class, class)
+			}
+		})
+	}
+
+	// rejected credentials are matched by error type, no matter how deeply wrapped
+	// nor how the message reads.
+	wrapped := fmt.Errorf(
+		"probing registry: %w", docker.ErrUnauthorizedForCredentials{
+			Err: fmt.Errorf("status code 401"),
+		},
+	)
+	if class := classifyRegistryError(wrapped); class != "authentication error" {
+		t.Errorf("expecting class %q, received %q", "authentication error", class)
+	}
+}
+
 func TestImportPath(t *testing.T) {
 	for _, tt := range []struct {
 		name   string
@@ -422,3 +550,562 @@ func TestImportPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_validatePlatform(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		platform string
+		err      string
+	}{
+		{
+			name:     "empty platform",
+			platform: "",
+		},
+		{
+			name:     "os and arch",
+			platform: "linux/amd64",
+		},
+		{
+			name:     "os, arch and variant",
+			platform: "linux/arm64/v8",
+		},
+		{
+			name:     "missing arch",
+			platform: "linux",
+			err:      "expected os/arch",
+		},
+		{
+			name:     "too many components",
+			platform: "linux/arm64/v8/extra",
+			err:      "expected os/arch",
+		},
+		{
+			name:     "empty component",
+			platform: "linux//v8",
+			err:      "empty component",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePlatform(tt.platform)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("unexpected error content %s", err)
+				}
+				return
+			}
+			if len(tt.err) > 0 {
+				t.Errorf("expecting error %q, nil received", tt.err)
+			}
+		})
+	}
+}
+
+func Test_choosePlatformInstance(t *testing.T) {
+	idx := `{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.index.v1+json",
+		"manifests": [
+			{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest": "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				"size": 100,
+				"platform": {"os": "linux", "architecture": "amd64"}
+			},
+			{
+				"mediaType": "application/vnd.oci.image.manifest.v1+json",
+				"digest": "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"size": 100,
+				"platform": {"os": "linux", "architecture": "arm64", "variant": "v8"}
+			}
+		]
+	}`
+	mtype := "application/vnd.oci.image.index.v1+json"
+
+	dgst, err := choosePlatformInstance([]byte(idx), mtype, "linux/arm64/v8")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !strings.HasPrefix(string(dgst), "sha256:bbbb") {
+		t.Errorf("unexpected digest %s for linux/arm64/v8", dgst)
+	}
+
+	dgst, err = choosePlatformInstance([]byte(idx), mtype, "linux/amd64")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if !strings.HasPrefix(string(dgst), "sha256:aaaa") {
+		t.Errorf("unexpected digest %s for linux/amd64", dgst)
+	}
+
+	// a platform without an architecture component must be reported as an error, not
+	// panic. Malformed objects reach the sync path when the admission webhook is
+	// absent or ignoring failures.
+	if _, err = choosePlatformInstance([]byte(idx), mtype, "linux"); err == nil {
+		t.Error("expecting error for platform without architecture, nil received")
+	}
+}
+
+func Test_familiarReference(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ref  string
+		exp  string
+	}{
+		{
+			name: "docker.io library image",
+			ref:  "docker.io/library/centos:latest",
+			exp:  "centos:latest",
+		},
+		{
+			name: "docker.io library image by digest",
+			ref:  "docker.io/library/centos@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			exp:  "centos@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+		},
+		{
+			name: "docker.io user image",
+			ref:  "docker.io/tagger/tagger:latest",
+			exp:  "tagger/tagger:latest",
+		},
+		{
+			name: "other registries are untouched",
+			ref:  "quay.io/tagger/tagger:latest",
+			exp:  "quay.io/tagger/tagger:latest",
+		},
+		{
+			name: "unparseable references are untouched",
+			ref:  "not a reference",
+			exp:  "not a reference",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := familiarReference(tt.ref); res != tt.exp {
+				t.Errorf("expected %q, received %q", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_ImportTimeoutFor(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		timeout string
+		maxcfg  string
+		exp     time.Duration
+	}{
+		{
+			name: "default timeout",
+			exp:  DefaultImportTimeout,
+		},
+		{
+			name:    "custom timeout",
+			timeout: "10m",
+			exp:     10 * time.Minute,
+		},
+		{
+			name:    "invalid timeout",
+			timeout: "a while",
+			exp:     DefaultImportTimeout,
+		},
+		{
+			name:    "timeout above default cap",
+			timeout: "26h",
+			exp:     MaxImportTimeout,
+		},
+		{
+			name:    "timeout above configured cap",
+			timeout: "30m",
+			maxcfg:  "15m",
+			exp:     15 * time.Minute,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var corObjects []runtime.Object
+			if tt.maxcfg != "" {
+				corObjects = append(corObjects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: map[string]string{
+						"maxImportTimeout": tt.maxcfg,
+					},
+				})
+			}
+
+			corcli := corfake.NewSimpleClientset(corObjects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			svc := NewImageImport(corinf, nil, nil)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			ii := &imgv1b1.ImageImport{
+				Spec: imgv1b1.ImageImportSpec{
+					TargetImage:   "myimg",
+					ImportTimeout: tt.timeout,
+				},
+			}
+			if res := svc.ImportTimeoutFor(ii); res != tt.exp {
+				t.Errorf("expecting timeout %s, received %s", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_allowedManifestType(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		allowlist string
+		mtype     string
+		err       string
+	}{
+		{
+			name:  "no allowlist",
+			mtype: "application/vnd.docker.distribution.manifest.v2+json",
+		},
+		{
+			name:      "allowed media type",
+			allowlist: "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json",
+			mtype:     "application/vnd.docker.distribution.manifest.v2+json",
+		},
+		{
+			name:      "rejected media type",
+			allowlist: "application/vnd.oci.image.manifest.v1+json",
+			mtype:     "application/vnd.docker.distribution.manifest.v2+json",
+			err:       "not allowed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var corObjects []runtime.Object
+			if tt.allowlist != "" {
+				corObjects = append(corObjects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: map[string]string{
+						"allowedManifestTypes": tt.allowlist,
+					},
+				})
+			}
+
+			corcli := corfake.NewSimpleClientset(corObjects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			svc := NewImageImport(corinf, nil, nil)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			err := svc.allowedManifestType(tt.mtype)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting error %q, received %q", tt.err, err)
+				}
+				return
+			}
+			if len(tt.err) > 0 {
+				t.Error("expecting error, nil received")
+			}
+		})
+	}
+}
+
+func Test_checkImageSize(t *testing.T) {
+	manblob := []byte(`{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		"config": {
+			"mediaType": "application/vnd.docker.container.image.v1+json",
+			"size": 100,
+			"digest": "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		},
+		"layers": [
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"size": 1000,
+				"digest": "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+			},
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"size": 2000,
+				"digest": "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+			}
+		]
+	}`)
+	mtype := "application/vnd.docker.distribution.manifest.v2+json"
+
+	for _, tt := range []struct {
+		name    string
+		maxSize int64
+		err     string
+	}{
+		{
+			name:    "no limit",
+			maxSize: 0,
+		},
+		{
+			name:    "under the limit",
+			maxSize: 5000,
+		},
+		{
+			name:    "over the limit",
+			maxSize: 2500,
+			err:     "exceeds the configured limit",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImageSize(manblob, mtype, tt.maxSize)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting error %q, received %q", tt.err, err)
+				}
+				return
+			}
+			if len(tt.err) > 0 {
+				t.Error("expecting error, nil received")
+			}
+		})
+	}
+}
+
+func Test_domainMatchesAny(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		domain   string
+		patterns []string
+		exp      bool
+	}{
+		{
+			name:   "no patterns",
+			domain: "docker.io",
+		},
+		{
+			name:     "exact match",
+			domain:   "registry.corp.example",
+			patterns: []string{"docker.io", "registry.corp.example"},
+			exp:      true,
+		},
+		{
+			name:     "no match",
+			domain:   "quay.io",
+			patterns: []string{"docker.io", "registry.corp.example"},
+		},
+		{
+			name:     "wildcard matches subdomain",
+			domain:   "registry.corp.example",
+			patterns: []string{"*.corp.example"},
+			exp:      true,
+		},
+		{
+			name:     "wildcard matches nested subdomain",
+			domain:   "cache.registry.corp.example",
+			patterns: []string{"*.corp.example"},
+			exp:      true,
+		},
+		{
+			name:     "wildcard does not match bare domain",
+			domain:   "corp.example",
+			patterns: []string{"*.corp.example"},
+		},
+		{
+			name:     "exact match with port",
+			domain:   "registry.corp.example:5000",
+			patterns: []string{"registry.corp.example:5000"},
+			exp:      true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := domainMatchesAny(tt.domain, tt.patterns); res != tt.exp {
+				t.Errorf("expecting %v, %v received", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_importNameFor(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		target string
+		suffix string
+		exp    string
+	}{
+		{
+			name:   "short target is kept intact",
+			target: "myapp",
+			suffix: "abcd1234",
+			exp:    "myapp-abcd1234",
+		},
+		{
+			name:   "target at the boundary is kept intact",
+			target: strings.Repeat("a", 244),
+			suffix: "abcd1234",
+			exp:    strings.Repeat("a", 244) + "-abcd1234",
+		},
+		{
+			name:   "too long target is truncated",
+			target: strings.Repeat("a", 300),
+			suffix: "abcd1234",
+			exp:    strings.Repeat("a", 244) + "-abcd1234",
+		},
+		{
+			name:   "truncation drops trailing separators",
+			target: strings.Repeat("a", 243) + "." + strings.Repeat("b", 56),
+			suffix: "abcd1234",
+			exp:    strings.Repeat("a", 243) + "-abcd1234",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := importNameFor(tt.target, tt.suffix)
+			if res != tt.exp {
+				t.Errorf("expecting %q, %q received", tt.exp, res)
+			}
+			if len(res) > 253 {
+				t.Errorf("generated name exceeds limit: %d chars", len(res))
+			}
+		})
+	}
+}
+
+func Test_ImageNameForReference(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		from string
+		exp  string
+	}{
+		{
+			name: "tagged reference",
+			from: "quay.io/repo/app:v1",
+			exp:  "repo-app-v1",
+		},
+		{
+			name: "unqualified reference gains the default path",
+			from: "centos:latest",
+			exp:  "library-centos-latest",
+		},
+		{
+			name: "reference by digest drops the digest",
+			from: "quay.io/repo/app@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+			exp:  "repo-app",
+		},
+		{
+			name: "deep repository paths are flattened",
+			from: "registry.io/team/project/app:1.0",
+			exp:  "team-project-app-1.0",
+		},
+		{
+			name: "unparseable references are sanitized as a whole",
+			from: "not??a##reference",
+			exp:  "not-a-reference",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := ImageNameForReference(tt.from); res != tt.exp {
+				t.Errorf("expecting name %q, received %q", tt.exp, res)
+			}
+		})
+	}
+
+	// references too long for the kubernetes name limit are truncated with a
+	// disambiguation hash appended, two such references must not collide.
+	longa := fmt.Sprintf("registry.io/%s/app:latest", strings.Repeat("a", 300))
+	longb := fmt.Sprintf("registry.io/%s/app:stable", strings.Repeat("a", 300))
+	namea := ImageNameForReference(longa)
+	nameb := ImageNameForReference(longb)
+	if len(namea) > 253 || len(nameb) > 253 {
+		t.Errorf("generated names exceed limit: %d and %d", len(namea), len(nameb))
+	}
+	if namea == nameb {
+		t.Errorf("distinct references collided into %q", namea)
+	}
+}
+
+func Test_mirrorLoops(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		regaddr   string
+		registry  string
+		remainder string
+		ns        string
+		img       string
+		exp       bool
+	}{
+		{
+			name:      "source hosted elsewhere",
+			regaddr:   "10.1.1.1:5000",
+			registry:  "quay.io",
+			remainder: "repo/myapp:latest",
+			ns:        "default",
+			img:       "myapp",
+		},
+		{
+			name:      "source in the mirror but another repository",
+			regaddr:   "10.1.1.1:5000",
+			registry:  "10.1.1.1:5000",
+			remainder: "staging/myapp@sha256:abc",
+			ns:        "prod",
+			img:       "myapp",
+		},
+		{
+			name:      "source is its own mirror repository",
+			regaddr:   "10.1.1.1:5000",
+			registry:  "10.1.1.1:5000",
+			remainder: "default/myapp@sha256:abc",
+			ns:        "default",
+			img:       "myapp",
+			exp:       true,
+		},
+		{
+			name:      "source is its own mirror repository by tag",
+			regaddr:   "10.1.1.1:5000",
+			registry:  "10.1.1.1:5000",
+			remainder: "default/myapp:latest",
+			ns:        "default",
+			img:       "myapp",
+			exp:       true,
+		},
+		{
+			name:      "source is its own repository under single repo layout",
+			regaddr:   "10.1.1.1:5000",
+			registry:  "10.1.1.1:5000",
+			remainder: "tagger/default-myapp@sha256:abc",
+			ns:        "default",
+			img:       "myapp",
+			exp:       true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := mirrorLoops(tt.regaddr, tt.registry, tt.remainder, tt.ns, tt.img)
+			if res != tt.exp {
+				t.Errorf("expecting %v, received %v", tt.exp, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelist "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	"github.com/hashicorp/go-multierror"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgclient "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+	imglist "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/listers/images/v1beta1"
+)
+
+// ImageListConfigMapName holds the name of the ConfigMap we reconcile declarative image
+// lists from. One such ConfigMap may exist per namespace.
+var ImageListConfigMapName = "tagger-image-list"
+
+// ManagedByListAnnotation is set in every Image created from a declarative image list. We
+// only ever prune Images carrying this annotation, Images created by users directly are
+// never touched.
+var ManagedByListAnnotation = "tagger.dev/managed-by-list"
+
+// ImageList reconciles declarative lists of image references into Image objects. Users
+// (GitOps pipelines, most likely) maintain a ConfigMap holding one image reference per
+// line, we guarantee an Image object exists for each entry.
+type ImageList struct {
+	corinf informers.SharedInformerFactory
+	cmlis  corelist.ConfigMapLister
+	imglis imglist.ImageLister
+	imgcli imgclient.Interface
+	syssvc *SysContext
+}
+
+// NewImageList returns a handler for declarative image list related services. As in the
+// other services in this package parameters may be nil, it is up to the caller to provide
+// what is needed for each specific use case.
+func NewImageList(
+	corinf informers.SharedInformerFactory,
+	imgcli imgclient.Interface,
+	imginf imginform.SharedInformerFactory,
+) *ImageList {
+	var cmlis corelist.ConfigMapLister
+	if corinf != nil {
+		cmlis = corinf.Core().V1().ConfigMaps().Lister()
+	}
+
+	var imglis imglist.ImageLister
+	if imginf != nil {
+		imglis = imginf.Tagger().V1beta1().Images().Lister()
+	}
+
+	return &ImageList{
+		corinf: corinf,
+		cmlis:  cmlis,
+		imglis: imglis,
+		imgcli: imgcli,
+		syssvc: NewSysContext(corinf),
+	}
+}
+
+// Sync reconciles the namespace Images with the image references listed in the provided
+// ConfigMap. ConfigMaps by any other name are ignored, this makes this service safe to be
+// called for every ConfigMap event. References are read from the "images" property, one
+// per line, lines starting with "#" are skipped. Entries removed from the list only have
+// their Image deleted when the ConfigMap sets "prune" to "true", and even then only if
+// the Image was created by us.
+func (l *ImageList) Sync(ctx context.Context, cm *corev1.ConfigMap) error {
+	if cm.Name != ImageListConfigMapName {
+		return nil
+	}
+
+	if l.syssvc.Paused() {
+		klog.Warningf(
+			"reconciliation paused through operator config, skipping list %s/%s",
+			cm.Namespace, cm.Name,
+		)
+		return nil
+	}
+
+	wanted := map[string]string{}
+	for _, line := range strings.Split(cm.Data["images"], "\n") {
+		ref := strings.TrimSpace(line)
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			continue
+		}
+
+		name, err := imageNameForReference(ref)
+		if err != nil {
+			return err
+		}
+		wanted[name] = ref
+	}
+
+	var errors *multierror.Error
+	for name, ref := range wanted {
+		if err := l.ensureListedImage(ctx, cm.Namespace, name, ref); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+
+	if cm.Data["prune"] == "true" {
+		if err := l.pruneUnlistedImages(ctx, cm.Namespace, wanted); err != nil {
+			errors = multierror.Append(errors, err)
+		}
+	}
+	return errors.ErrorOrNil()
+}
+
+// ensureListedImage guarantees an Image by provided name exists in the namespace and
+// points to provided reference. Images we manage are updated in place when the list
+// entry changes, Images created by users are left alone.
+func (l *ImageList) ensureListedImage(ctx context.Context, namespace, name, ref string) error {
+	img, err := l.imglis.Images(namespace).Get(name)
+	if err == nil {
+		if img.Annotations[ManagedByListAnnotation] != "true" || img.Spec.From == ref {
+			return nil
+		}
+
+		img = img.DeepCopy()
+		img.Spec.From = ref
+		if _, err := l.imgcli.TaggerV1beta1().Images(namespace).Update(
+			ctx, img, metav1.UpdateOptions{},
+		); err != nil {
+			return fmt.Errorf("unable to update image %s/%s: %w", namespace, name, err)
+		}
+		klog.Infof("image %s/%s updated to %s", namespace, name, ref)
+		return nil
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to get image %s/%s: %w", namespace, name, err)
+	}
+
+	img = &imgv1b1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				ManagedByListAnnotation: "true",
+			},
+		},
+		Spec: imgv1b1.ImageSpec{
+			From: ref,
+		},
+	}
+	if _, err := l.imgcli.TaggerV1beta1().Images(namespace).Create(
+		ctx, img, metav1.CreateOptions{},
+	); err != nil {
+		if errors.IsAlreadyExists(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to create image %s/%s: %w", namespace, name, err)
+	}
+
+	klog.Infof("image %s/%s created for %s", namespace, name, ref)
+	return nil
+}
+
+// pruneUnlistedImages deletes, in the provided namespace, all Images we manage that are
+// not part of provided wanted set (a map from Image name to image reference).
+func (l *ImageList) pruneUnlistedImages(
+	ctx context.Context, namespace string, wanted map[string]string,
+) error {
+	imgs, err := l.imglis.Images(namespace).List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("unable to list images: %w", err)
+	}
+
+	var errors *multierror.Error
+	for _, img := range imgs {
+		if img.Annotations[ManagedByListAnnotation] != "true" {
+			continue
+		}
+		if _, ok := wanted[img.Name]; ok {
+			continue
+		}
+
+		if err := l.imgcli.TaggerV1beta1().Images(namespace).Delete(
+			ctx, img.Name, metav1.DeleteOptions{},
+		); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf(
+				"unable to delete image %s/%s: %w", namespace, img.Name, err,
+			))
+			continue
+		}
+		klog.Infof("image %s/%s pruned, no longer listed", namespace, img.Name)
+	}
+	return errors.ErrorOrNil()
+}
+
+// Get returns a ConfigMap object. Returned object is already a copy of the cached object
+// and may be modified by caller as needed.
+func (l *ImageList) Get(ctx context.Context, ns, name string) (*corev1.ConfigMap, error) {
+	cm, err := l.cmlis.ConfigMaps(ns).Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get config map: %w", err)
+	}
+	return cm.DeepCopy(), nil
+}
+
+// AddEventHandler adds a handler to ConfigMap related events.
+func (l *ImageList) AddEventHandler(handler cache.ResourceEventHandler) {
+	l.corinf.Core().V1().ConfigMaps().Informer().AddEventHandler(handler)
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	coreinf "k8s.io/client-go/informers"
+	corfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgfake "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned/fake"
+	imginform "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/informers/externalversions"
+)
+
+func TestImageListSync(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		cm         *corev1.ConfigMap
+		imgObjects []runtime.Object
+		expImages  map[string]string
+	}{
+		{
+			name: "config map by another name",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "another-config-map",
+				},
+				Data: map[string]string{
+					"images": "quay.io/repo/myapp:latest",
+				},
+			},
+			expImages: map[string]string{},
+		},
+		{
+			name: "images created for listed references",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      ImageListConfigMapName,
+				},
+				Data: map[string]string{
+					"images": `
+					# comment lines and blanks are skipped
+					quay.io/repo/myapp:latest
+					quay.io/repo/sidecar:v1
+					`,
+				},
+			},
+			expImages: map[string]string{
+				"myapp":   "quay.io/repo/myapp:latest",
+				"sidecar": "quay.io/repo/sidecar:v1",
+			},
+		},
+		{
+			name: "managed image updated when the list entry changes",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      ImageListConfigMapName,
+				},
+				Data: map[string]string{
+					"images": "quay.io/repo/myapp:v2",
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+						Annotations: map[string]string{
+							ManagedByListAnnotation: "true",
+						},
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "quay.io/repo/myapp:v1",
+					},
+				},
+			},
+			expImages: map[string]string{
+				"myapp": "quay.io/repo/myapp:v2",
+			},
+		},
+		{
+			name: "user created image left alone",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      ImageListConfigMapName,
+				},
+				Data: map[string]string{
+					"images": "quay.io/repo/myapp:v2",
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "myapp",
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "quay.io/repo/myapp:v1",
+					},
+				},
+			},
+			expImages: map[string]string{
+				"myapp": "quay.io/repo/myapp:v1",
+			},
+		},
+		{
+			name: "unlisted images kept when prune is not set",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      ImageListConfigMapName,
+				},
+				Data: map[string]string{
+					"images": "quay.io/repo/myapp:latest",
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "oldapp",
+						Annotations: map[string]string{
+							ManagedByListAnnotation: "true",
+						},
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "quay.io/repo/oldapp:latest",
+					},
+				},
+			},
+			expImages: map[string]string{
+				"myapp":  "quay.io/repo/myapp:latest",
+				"oldapp": "quay.io/repo/oldapp:latest",
+			},
+		},
+		{
+			name: "unlisted managed image pruned",
+			cm: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      ImageListConfigMapName,
+				},
+				Data: map[string]string{
+					"images": "quay.io/repo/myapp:latest",
+					"prune":  "true",
+				},
+			},
+			imgObjects: []runtime.Object{
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "oldapp",
+						Annotations: map[string]string{
+							ManagedByListAnnotation: "true",
+						},
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "quay.io/repo/oldapp:latest",
+					},
+				},
+				&imgv1b1.Image{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "usrapp",
+					},
+					Spec: imgv1b1.ImageSpec{
+						From: "quay.io/repo/usrapp:latest",
+					},
+				},
+			},
+			expImages: map[string]string{
+				"myapp":  "quay.io/repo/myapp:latest",
+				"usrapp": "quay.io/repo/usrapp:latest",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			corcli := corfake.NewSimpleClientset()
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			imgcli := imgfake.NewSimpleClientset(tt.imgObjects...)
+			imginf := imginform.NewSharedInformerFactory(imgcli, time.Minute)
+
+			svc := NewImageList(corinf, imgcli, imginf)
+
+			corinf.Start(ctx.Done())
+			imginf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+				imginf.Tagger().V1beta1().Images().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			if err := svc.Sync(ctx, tt.cm); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			imgs, err := imgcli.TaggerV1beta1().Images(tt.cm.Namespace).List(
+				ctx, metav1.ListOptions{},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error listing images: %s", err)
+			}
+			if len(imgs.Items) != len(tt.expImages) {
+				t.Fatalf(
+					"expecting %d images, %d found",
+					len(tt.expImages), len(imgs.Items),
+				)
+			}
+
+			for _, img := range imgs.Items {
+				from, ok := tt.expImages[img.Name]
+				if !ok {
+					t.Errorf("unexpected image %s found", img.Name)
+					continue
+				}
+				if img.Spec.From != from {
+					t.Errorf(
+						"expected image %s to point to %s, found %s",
+						img.Name, from, img.Spec.From,
+					)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+
+	"github.com/ricardomaraschini/tagger/infra/metrics"
+)
+
+// LayerStatsCacheDuration indicates for how long a computed LayerStats remains valid. Walking
+// all mirrored manifests is expensive so we serve a cached copy for a while instead of hitting
+// the mirror registry on every request.
+var LayerStatsCacheDuration = time.Hour
+
+// LayerStats summarizes how much layer data is shared among the images tagger mirrors.
+// TotalLayers counts every layer referenced by mirrored manifests while UniqueLayers counts
+// distinct layer digests only, the gap between both is data the registry storage deduplicates.
+type LayerStats struct {
+	Images       int
+	TotalLayers  int
+	UniqueLayers int
+	ComputedAt   time.Time
+}
+
+// MirrorLayerStats walks all mirrored Images, fetches their manifests from the mirror registry
+// and tallies unique against total layer digests. This is a read only analysis, results are
+// cached for LayerStatsCacheDuration and also exported through the mirror layers metrics.
+func (t *Image) MirrorLayerStats(ctx context.Context) (LayerStats, error) {
+	t.statmtx.Lock()
+	defer t.statmtx.Unlock()
+
+	if time.Since(t.layerstats.ComputedAt) < LayerStatsCacheDuration {
+		return t.layerstats, nil
+	}
+
+	imgs, err := t.imglis.List(labels.Everything())
+	if err != nil {
+		return LayerStats{}, fmt.Errorf("unable to list images: %w", err)
+	}
+
+	var stats LayerStats
+	seen := map[digest.Digest]bool{}
+	for _, img := range imgs {
+		if !img.Spec.Mirror || len(img.Status.HashReferences) == 0 {
+			continue
+		}
+
+		stats.Images++
+		sysctx := t.syssvc.MirrorRegistryContext(ctx, img.Namespace)
+		for _, hashref := range img.Status.HashReferences {
+			layers, err := t.layersForReference(
+				ctx, hashref.ImageReference, sysctx,
+			)
+			if err != nil {
+				return LayerStats{}, fmt.Errorf(
+					"unable to read layers for %s: %w",
+					hashref.ImageReference,
+					err,
+				)
+			}
+
+			for _, dgst := range layers {
+				stats.TotalLayers++
+				seen[dgst] = true
+			}
+		}
+	}
+	stats.UniqueLayers = len(seen)
+	stats.ComputedAt = time.Now()
+
+	metrics.MirrorTotalLayers.Set(float64(stats.TotalLayers))
+	metrics.MirrorUniqueLayers.Set(float64(stats.UniqueLayers))
+
+	t.layerstats = stats
+	return stats, nil
+}
+
+// layersForReference fetches the manifest for the provided image reference and returns the
+// digests for all layers it points to. Manifest lists are expanded, layers of all instances
+// are accounted for as they all live in the mirror.
+func (t *Image) layersForReference(
+	ctx context.Context, refstr string, sysctx *types.SystemContext,
+) ([]digest.Digest, error) {
+	imgref, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", refstr))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	src, err := imgref.NewImageSource(ctx, sysctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access image: %w", err)
+	}
+	defer src.Close()
+
+	manblob, mtype, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch manifest: %w", err)
+	}
+
+	if !manifest.MIMETypeIsMultiImage(mtype) {
+		return layerDigestsForManifest(manblob, mtype)
+	}
+
+	list, err := manifest.ListFromBlob(manblob, mtype)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest list: %w", err)
+	}
+
+	var layers []digest.Digest
+	for _, instdgst := range list.Instances() {
+		instdgst := instdgst
+		instblob, insttype, err := src.GetManifest(ctx, &instdgst)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch instance manifest: %w", err)
+		}
+
+		instlayers, err := layerDigestsForManifest(instblob, insttype)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, instlayers...)
+	}
+	return layers, nil
+}
+
+// layerDigestsForManifest parses a single image manifest blob and returns the digests of all
+// layers it references.
+func layerDigestsForManifest(manblob []byte, mtype string) ([]digest.Digest, error) {
+	man, err := manifest.FromBlob(manblob, mtype)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse manifest: %w", err)
+	}
+
+	infos := man.LayerInfos()
+	layers := make([]digest.Digest, len(infos))
+	for i, info := range infos {
+		layers[i] = info.Digest
+	}
+	return layers, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func Test_layerDigestsForManifest(t *testing.T) {
+	dockerman := `{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+		"config": {
+			"mediaType": "application/vnd.docker.container.image.v1+json",
+			"size": 100,
+			"digest": "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		},
+		"layers": [
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"size": 100,
+				"digest": "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+			},
+			{
+				"mediaType": "application/vnd.docker.image.rootfs.diff.tar.gzip",
+				"size": 100,
+				"digest": "sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc"
+			}
+		]
+	}`
+
+	ociman := `{
+		"schemaVersion": 2,
+		"mediaType": "application/vnd.oci.image.manifest.v1+json",
+		"config": {
+			"mediaType": "application/vnd.oci.image.config.v1+json",
+			"size": 100,
+			"digest": "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		},
+		"layers": [
+			{
+				"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+				"size": 100,
+				"digest": "sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd"
+			}
+		]
+	}`
+
+	for _, tt := range []struct {
+		name    string
+		manblob string
+		mtype   string
+		err     string
+		layers  []string
+	}{
+		{
+			name:    "docker v2 manifest",
+			manblob: dockerman,
+			mtype:   manifest.DockerV2Schema2MediaType,
+			layers: []string{
+				"sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				"sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc",
+			},
+		},
+		{
+			name:    "oci manifest",
+			manblob: ociman,
+			mtype:   imgspecv1.MediaTypeImageManifest,
+			layers: []string{
+				"sha256:dddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddddd",
+			},
+		},
+		{
+			name:    "invalid manifest",
+			manblob: "not a manifest",
+			mtype:   manifest.DockerV2Schema2MediaType,
+			err:     "unable to parse manifest",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			layers, err := layerDigestsForManifest([]byte(tt.manblob), tt.mtype)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("unexpected error content: %s", err)
+				}
+				return
+			} else if len(tt.err) > 0 {
+				t.Errorf("expecting error %q, nil received", tt.err)
+				return
+			}
+
+			if len(layers) != len(tt.layers) {
+				t.Fatalf("expecting %d layers, %d received", len(tt.layers), len(layers))
+			}
+			for i, dgst := range layers {
+				if dgst.String() != tt.layers[i] {
+					t.Errorf("unexpected layer %s at %d", dgst, i)
+				}
+			}
+		})
+	}
+}
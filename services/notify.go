@@ -0,0 +1,122 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+)
+
+// Terminal import outcomes we may notify external sinks about. These are also the values
+// accepted in the "notificationEvents" operator config property.
+const (
+	NotifyEventSuccess = "success"
+	NotifyEventFailure = "failure"
+)
+
+// notificationTimeout caps how long we wait for the notification endpoint to reply. The
+// whole notification path is fire and forget, a slow sink must never hold reconciliation.
+var notificationTimeout = 5 * time.Second
+
+// importNotification is the JSON payload POSTed to the configured notification endpoint
+// on terminal import outcomes.
+type importNotification struct {
+	Event       string      `json:"event"`
+	Namespace   string      `json:"namespace"`
+	Name        string      `json:"name"`
+	TargetImage string      `json:"targetImage"`
+	Reason      string      `json:"reason,omitempty"`
+	When        metav1.Time `json:"when"`
+}
+
+// notifyImportOutcome POSTs a summary of a terminal import outcome (first success or
+// permanent failure) to the webhook configured through the "notificationWebhook" operator
+// config property. Which events are sent is selected through "notificationEvents", a comma
+// separated list of events, empty meaning all of them. Callers run this in its own
+// goroutine, failures are logged and forgotten.
+func (t *ImageImport) notifyImportOutcome(event string, ii *imgv1b1.ImageImport, reason string) {
+	cfg := t.syssvc.OperatorConfig()
+	url := cfg["notificationWebhook"]
+	if url == "" {
+		return
+	}
+
+	if events := cfg["notificationEvents"]; events != "" {
+		var wanted bool
+		for _, evt := range strings.Split(events, ",") {
+			if strings.TrimSpace(evt) == event {
+				wanted = true
+				break
+			}
+		}
+		if !wanted {
+			return
+		}
+	}
+
+	notification := importNotification{
+		Event:       event,
+		Namespace:   ii.Namespace,
+		Name:        ii.Name,
+		TargetImage: ii.Spec.TargetImage,
+		Reason:      reason,
+		When:        metav1.NewTime(time.Now()),
+	}
+	if err := postImportNotification(url, notification); err != nil {
+		klog.Warningf(
+			"unable to notify import %s/%s outcome: %s",
+			ii.Namespace, ii.Name, err,
+		)
+	}
+}
+
+// postImportNotification delivers provided notification to the provided url as a JSON
+// POST, honoring notificationTimeout.
+func postImportNotification(url string, notification importNotification) error {
+	buf, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("unable to encode notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return fmt.Errorf("unable to create notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification endpoint replied %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	coreinf "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+)
+
+func Test_notifyImportOutcome(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		event    string
+		events   string
+		webhook  bool
+		expcalls int
+	}{
+		{
+			name:     "no webhook configured",
+			event:    NotifyEventSuccess,
+			expcalls: 0,
+		},
+		{
+			name:     "all events sent by default",
+			event:    NotifyEventSuccess,
+			webhook:  true,
+			expcalls: 1,
+		},
+		{
+			name:     "event selected for notification",
+			event:    NotifyEventFailure,
+			events:   "success,failure",
+			webhook:  true,
+			expcalls: 1,
+		},
+		{
+			name:     "event filtered out",
+			event:    NotifyEventSuccess,
+			events:   "failure",
+			webhook:  true,
+			expcalls: 0,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var calls int
+			var received importNotification
+			srv := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					calls++
+					if err := json.NewDecoder(r.Body).Decode(
+						&received,
+					); err != nil {
+						t.Errorf("error decoding payload: %s", err)
+					}
+				},
+			))
+			defer srv.Close()
+
+			cfg := map[string]string{}
+			if tt.webhook {
+				cfg["notificationWebhook"] = srv.URL
+			}
+			if tt.events != "" {
+				cfg["notificationEvents"] = tt.events
+			}
+
+			corcli := fake.NewSimpleClientset(&corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "tagger",
+					Name:      "tagger-config",
+				},
+				Data: cfg,
+			})
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			svc := NewImageImport(corinf, nil, nil)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			ii := &imgv1b1.ImageImport{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myapp-abc123",
+				},
+				Spec: imgv1b1.ImageImportSpec{
+					TargetImage: "myapp",
+				},
+			}
+			svc.notifyImportOutcome(tt.event, ii, "something broke")
+
+			if calls != tt.expcalls {
+				t.Fatalf("expecting %d calls, %d seen", tt.expcalls, calls)
+			}
+			if calls == 0 {
+				return
+			}
+			if received.Event != tt.event {
+				t.Errorf("expecting event %q, %q received", tt.event, received.Event)
+			}
+			if received.TargetImage != "myapp" {
+				t.Errorf("unexpected target image %q", received.TargetImage)
+			}
+			if received.Reason != "something broke" {
+				t.Errorf("unexpected reason %q", received.Reason)
+			}
+		})
+	}
+}
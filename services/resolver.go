@@ -0,0 +1,45 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+)
+
+// Resolver answers "given this image reference, what should actually be imported". The
+// import flow consults the configured Resolver before probing the registry, allowing
+// organizations to plug in custom resolution logic such as internal promotion rules or
+// approval gates. A Resolver returning a nil reference expresses no opinion and the
+// built-in registry probing takes over. References returned by a Resolver still go
+// through the regular probing path so policy checks run and working credentials are
+// found for them.
+type Resolver interface {
+	Resolve(
+		ctx context.Context, imgref types.ImageReference, namespace string,
+	) (types.ImageReference, error)
+}
+
+// defaultResolver is the built-in Resolver, it has no opinion on any reference thus
+// keeping imports resolving digests directly against the source registry.
+type defaultResolver struct{}
+
+// Resolve implements Resolver by always deferring to the built-in registry probing.
+func (d defaultResolver) Resolve(
+	ctx context.Context, imgref types.ImageReference, namespace string,
+) (types.ImageReference, error) {
+	return nil, nil
+}
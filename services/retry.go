@@ -0,0 +1,90 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgclient "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned"
+)
+
+// maxStatusUpdateRetries is the number of times we refetch an object and reapply a status
+// mutation after an update conflict before giving up and surfacing the error.
+var maxStatusUpdateRetries = 3
+
+// updateImageStatus applies the provided mutation to an Image and updates its status on the
+// api server. On conflicts the Image is refetched, the mutation reapplied and the update
+// retried a bounded number of times, avoiding spurious requeues during event bursts.
+func updateImageStatus(
+	ctx context.Context,
+	imgcli imgclient.Interface,
+	img *imgv1b1.Image,
+	mutate func(*imgv1b1.Image),
+) (*imgv1b1.Image, error) {
+	for attempt := 0; ; attempt++ {
+		mutate(img)
+
+		updated, err := imgcli.TaggerV1beta1().Images(img.Namespace).UpdateStatus(
+			ctx, img, metav1.UpdateOptions{},
+		)
+		if err == nil {
+			return updated, nil
+		}
+		if !errors.IsConflict(err) || attempt >= maxStatusUpdateRetries {
+			return nil, err
+		}
+
+		if img, err = imgcli.TaggerV1beta1().Images(img.Namespace).Get(
+			ctx, img.Name, metav1.GetOptions{},
+		); err != nil {
+			return nil, fmt.Errorf("unable to refetch image: %w", err)
+		}
+	}
+}
+
+// updateImageImportStatus applies the provided mutation to an ImageImport and updates its
+// status on the api server. On conflicts the ImageImport is refetched, the mutation reapplied
+// and the update retried a bounded number of times.
+func updateImageImportStatus(
+	ctx context.Context,
+	imgcli imgclient.Interface,
+	ii *imgv1b1.ImageImport,
+	mutate func(*imgv1b1.ImageImport),
+) (*imgv1b1.ImageImport, error) {
+	for attempt := 0; ; attempt++ {
+		mutate(ii)
+
+		updated, err := imgcli.TaggerV1beta1().ImageImports(ii.Namespace).UpdateStatus(
+			ctx, ii, metav1.UpdateOptions{},
+		)
+		if err == nil {
+			return updated, nil
+		}
+		if !errors.IsConflict(err) || attempt >= maxStatusUpdateRetries {
+			return nil, err
+		}
+
+		if ii, err = imgcli.TaggerV1beta1().ImageImports(ii.Namespace).Get(
+			ctx, ii.Name, metav1.GetOptions{},
+		); err != nil {
+			return nil, fmt.Errorf("unable to refetch image import: %w", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktesting "k8s.io/client-go/testing"
+
+	imgv1b1 "github.com/ricardomaraschini/tagger/infra/images/v1beta1"
+	imgfake "github.com/ricardomaraschini/tagger/infra/images/v1beta1/gen/clientset/versioned/fake"
+)
+
+func Test_updateImageStatus(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		conflicts int
+		err       string
+		mutations int
+	}{
+		{
+			name:      "no conflict",
+			conflicts: 0,
+			mutations: 1,
+		},
+		{
+			name:      "conflict then success",
+			conflicts: 2,
+			mutations: 3,
+		},
+		{
+			name:      "persistent conflict",
+			conflicts: maxStatusUpdateRetries + 1,
+			err:       "conflict",
+			mutations: maxStatusUpdateRetries + 1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := &imgv1b1.Image{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      "myimg",
+				},
+				Spec: imgv1b1.ImageSpec{
+					From: "centos:latest",
+				},
+			}
+
+			imgcli := imgfake.NewSimpleClientset(img.DeepCopy())
+
+			conflicts := tt.conflicts
+			imgcli.PrependReactor(
+				"update",
+				"images",
+				func(action ktesting.Action) (bool, runtime.Object, error) {
+					if action.GetSubresource() != "status" {
+						return false, nil, nil
+					}
+					if conflicts == 0 {
+						return false, nil, nil
+					}
+					conflicts--
+					return true, nil, errors.NewConflict(
+						schema.GroupResource{
+							Group:    "tagger.dev",
+							Resource: "images",
+						},
+						img.Name,
+						fmt.Errorf("object was modified"),
+					)
+				},
+			)
+
+			var mutations int
+			_, err := updateImageStatus(
+				context.Background(), imgcli, img,
+				func(img *imgv1b1.Image) {
+					mutations++
+					img.PrependImportFailure(imgv1b1.ImportFailure{
+						Name:   "myimport",
+						From:   img.Spec.From,
+						Reason: "testing",
+						When:   metav1.Now(),
+					})
+				},
+			)
+			if err != nil {
+				if len(tt.err) == 0 {
+					t.Errorf("unexpected error: %s", err)
+				} else if !errors.IsConflict(err) {
+					t.Errorf("expecting conflict error, received %s", err)
+				}
+			} else if len(tt.err) > 0 {
+				t.Error("expecting error, nil received")
+			}
+
+			if mutations != tt.mutations {
+				t.Errorf(
+					"expecting %d mutations, %d executed",
+					tt.mutations, mutations,
+				)
+			}
+		})
+	}
+}
@@ -18,7 +18,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
@@ -28,12 +33,19 @@ import (
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
 	"github.com/containers/image/v5/types"
 	"github.com/hashicorp/go-multierror"
+	"github.com/opencontainers/go-digest"
 	"github.com/ricardomaraschini/tagger/infra/imagestore"
 	"gopkg.in/yaml.v2"
 )
 
+// ServiceAccountTokenPath points to the projected service account token inside the pod. The
+// token is used as registry identity token when importing from configured internal registry
+// domains, see SysContext.InternalRegistryDomains.
+var ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
 // We use dockerAuthConfig to unmarshal a default docker configuration present on secrets of
 // type SecretTypeDockerConfigJson. XXX doesn't containers/image export a similar structure?
 // Or maybe even a function to parse a docker configuration file?
@@ -43,12 +55,30 @@ type dockerAuthConfig struct {
 
 // MirrorRegistryConfig holds the needed data that allows tagger to contact the mirror registry.
 type MirrorRegistryConfig struct {
-	Address    string
-	Username   string
-	Password   string
-	Repository string
-	Token      string
-	Insecure   bool
+	Address              string
+	Username             string
+	Password             string
+	Repository           string
+	Token                string
+	Insecure             bool
+	MaxParallelDownloads uint
+	PreCreateAPI         string
+}
+
+// Validate checks the mirror registry config is coherent, returning an error naming the
+// missing field when it is not. A partially populated secret used to surface only much
+// later as a cryptic push failure, we rather fail upfront with something actionable.
+func (m MirrorRegistryConfig) Validate() error {
+	if m.Address == "" {
+		return fmt.Errorf("missing address in mirror registry config")
+	}
+	if m.Username != "" && m.Password == "" {
+		return fmt.Errorf("missing password in mirror registry config (username is set)")
+	}
+	if m.Password != "" && m.Username == "" {
+		return fmt.Errorf("missing username in mirror registry config (password is set)")
+	}
+	return nil
 }
 
 // LocalRegistryHostingV1 describes a local registry that developer tools can connect to. A local
@@ -91,6 +121,8 @@ type SysContext struct {
 	sclister              corelister.SecretLister
 	cmlister              corelister.ConfigMapLister
 	unqualifiedRegistries []string
+	reghealthmtx          sync.Mutex
+	reghealth             map[string]int
 }
 
 // NewSysContext returns a new SysContext helper.
@@ -106,9 +138,56 @@ func NewSysContext(corinf informers.SharedInformerFactory) *SysContext {
 		sclister:              sclister,
 		cmlister:              cmlister,
 		unqualifiedRegistries: []string{"docker.io"},
+		reghealth:             map[string]int{},
 	}
 }
 
+// registryHealthScoreCap bounds per registry health scores so a long streak of successes
+// or failures does not take equally long to be forgotten once the registry flips state.
+const registryHealthScoreCap = 5
+
+// RecordRegistryOutcome tracks the result of probing the provided registry during an
+// import. Scores move up on success and down on failure, bounded by
+// registryHealthScoreCap, and feed the health based ordering applied by
+// RegistriesToSearch.
+func (s *SysContext) RecordRegistryOutcome(registry string, succeeded bool) {
+	s.reghealthmtx.Lock()
+	defer s.reghealthmtx.Unlock()
+
+	score := s.reghealth[registry]
+	if succeeded {
+		score++
+	} else {
+		score--
+	}
+	if score > registryHealthScoreCap {
+		score = registryHealthScoreCap
+	}
+	if score < -registryHealthScoreCap {
+		score = -registryHealthScoreCap
+	}
+	s.reghealth[registry] = score
+}
+
+// RegistryScore returns the current health score for the provided registry, zero for
+// registries we have not probed yet. Exposed so the ordering applied to the search list
+// can be inspected and tested.
+func (s *SysContext) RegistryScore(registry string) int {
+	s.reghealthmtx.Lock()
+	defer s.reghealthmtx.Unlock()
+	return s.reghealth[registry]
+}
+
+// sortByRegistryHealth reorders the provided registry list so registries with a better
+// recent track record are probed first. The sort is stable, registries with equal scores
+// keep their configured relative order.
+func (s *SysContext) sortByRegistryHealth(registries []string) []string {
+	sort.SliceStable(registries, func(i, j int) bool {
+		return s.RegistryScore(registries[i]) > s.RegistryScore(registries[j])
+	})
+	return registries
+}
+
 // UnqualifiedRegistries returns the list of unqualified registries configured on the system.
 // XXX this is a place holder as we most likely gonna need to read this from a configuration
 // somewhere.
@@ -136,12 +215,321 @@ func (s *SysContext) ParseMirrorRegistryConfig() (*LocalRegistryHostingV1, error
 	return cfg, nil
 }
 
-// MirrorConfig returns the mirror configuration as read from Tagger namespace or from the
-// kube-public namespace as per KEP.
-func (s *SysContext) MirrorConfig() (MirrorRegistryConfig, error) {
+// OperatorConfig returns the operator scoped configuration, read from the "tagger-config"
+// ConfigMap hosted in the operator namespace. Returns an empty config if the ConfigMap does
+// not exist, callers are expected to apply their own defaults.
+func (s *SysContext) OperatorConfig() map[string]string {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		return map[string]string{}
+	}
+
+	cm, err := s.cmlister.ConfigMaps(namespace).Get("tagger-config")
+	if err != nil {
+		return map[string]string{}
+	}
+	return cm.Data
+}
+
+// NormalizeReferences returns if recorded image references should be rewritten using their
+// short familiar form (e.g. centos:latest instead of docker.io/library/centos:latest). We
+// default to the full form to keep compatibility with existing deployments.
+func (s *SysContext) NormalizeReferences() bool {
+	return s.OperatorConfig()["normalizeReferences"] == "true"
+}
+
+// FetchCreatedTimestamps returns if imports should also fetch the image config blob in
+// order to record the image build timestamp. This costs one extra round trip to the
+// registry per import so it is disabled unless "fetchCreatedTimestamps" is set to "true"
+// in the operator ConfigMap.
+func (s *SysContext) FetchCreatedTimestamps() bool {
+	return s.OperatorConfig()["fetchCreatedTimestamps"] == "true"
+}
+
+// ManifestDigestAlgorithm returns the digest algorithm used when composing by-digest image
+// references during imports, the "manifestDigestAlgorithm" property in the operator
+// ConfigMap. Defaults to the canonical sha256, unknown or unavailable algorithms are
+// reported and ignored. Niche but real for environments matching a registry configured
+// with a non default digest algorithm.
+func (s *SysContext) ManifestDigestAlgorithm() digest.Algorithm {
+	raw := strings.TrimSpace(s.OperatorConfig()["manifestDigestAlgorithm"])
+	if raw == "" {
+		return digest.Canonical
+	}
+
+	algo := digest.Algorithm(raw)
+	if !algo.Available() {
+		klog.Warningf(
+			"invalid manifestDigestAlgorithm %q in operator config, using %s",
+			raw, digest.Canonical,
+		)
+		return digest.Canonical
+	}
+	return algo
+}
+
+// NamespaceMetricsEnabled returns if import counters broken down by namespace should be
+// recorded. Per namespace labels can explode metric cardinality on large clusters so
+// this is strictly opt in, through the "namespaceMetrics" operator config property.
+func (s *SysContext) NamespaceMetricsEnabled() bool {
+	return s.OperatorConfig()["namespaceMetrics"] == "true"
+}
+
+// NamespaceMetricsLimit returns the maximum number of distinct namespaces we are willing
+// to use as metric label values, namespaces beyond this cap are aggregated under a single
+// overflow label. Tuned through the "namespaceMetricsLimit" operator config property.
+func (s *SysContext) NamespaceMetricsLimit() int {
+	raw, ok := s.OperatorConfig()["namespaceMetricsLimit"]
+	if !ok {
+		return 100
+	}
+
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 1 {
+		klog.Warningf("invalid namespaceMetricsLimit %q, using default", raw)
+		return 100
+	}
+	return parsed
+}
+
+// Paused returns if reconciliation has been paused cluster wide through the "paused"
+// property of the operator ConfigMap. This works as an operational kill switch during
+// registry outages or maintenance windows: controllers keep running (webhooks and
+// probes stay up) but skip all mutating sync work until the flag is removed.
+func (s *SysContext) Paused() bool {
+	return s.OperatorConfig()["paused"] == "true"
+}
+
+// ResolveFloatingTags returns if imports should attempt to cross reference the resolved
+// digest with the other tags hosted in the source repository, recording in the import
+// history which immutable tag a floating tag pointed to. This costs extra round trips to
+// the registry so it is disabled unless "resolveFloatingTags" is set to "true" in the
+// operator ConfigMap.
+func (s *SysContext) ResolveFloatingTags() bool {
+	return s.OperatorConfig()["resolveFloatingTags"] == "true"
+}
+
+// CredentialProbeParallelism returns how many credentials we probe at once while resolving
+// an image digest. Defaults to 1 (sequential), probing registries in parallel with wrong
+// credentials may trigger account lockouts so anything above that is strictly opt in,
+// through the "credentialProbeParallelism" operator config property.
+func (s *SysContext) CredentialProbeParallelism() int {
+	raw, ok := s.OperatorConfig()["credentialProbeParallelism"]
+	if !ok {
+		return 1
+	}
+
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 1 {
+		klog.Warningf("invalid credentialProbeParallelism %q, probing sequentially", raw)
+		return 1
+	}
+	return parsed
+}
+
+// FailOnCredentialConflict returns if imports should be refused when more than one secret
+// in the namespace carries credentials for the registry being contacted. By default we try
+// all of them in sequence, setting the "onCredentialConflict" operator config property to
+// "fail" makes the import fail fast instead, requiring the user to remove the ambiguity.
+func (s *SysContext) FailOnCredentialConflict() bool {
+	raw, ok := s.OperatorConfig()["onCredentialConflict"]
+	if !ok {
+		return false
+	}
+
+	switch raw {
+	case "fail":
+		return true
+	case "tryAll":
+		return false
+	default:
+		klog.Warningf("invalid onCredentialConflict %q, trying all credentials", raw)
+		return false
+	}
+}
+
+// CaptureLabels returns which image config labels should be recorded in the import
+// history, the comma separated "captureLabels" operator config property. Capturing
+// labels costs one extra round trip to the registry per import (the config blob must
+// be fetched) so nothing is recorded unless keys are explicitly listed here.
+func (s *SysContext) CaptureLabels() []string {
+	raw, ok := s.OperatorConfig()["captureLabels"]
+	if !ok {
+		return nil
+	}
+
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// MirrorSkipRegistries returns the registry domains whose images should not be copied
+// into the mirror even when mirroring is requested, the upstream reference is recorded
+// directly instead. Useful to avoid pointless copies of images already hosted in a local
+// registry. Configured through the "mirrorSkipRegistries" property of the operator
+// ConfigMap, a comma separated list of domains where entries may start with "*." to
+// match a whole subdomain tree.
+func (s *SysContext) MirrorSkipRegistries() []string {
+	raw, ok := s.OperatorConfig()["mirrorSkipRegistries"]
+	if !ok {
+		return nil
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(raw, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// AllowedSourceRegistries returns the registry domains Images are allowed to import from,
+// the comma separated "allowedSourceRegistries" operator config property. Entries may be
+// exact domains (ports included) or "*." prefixed suffixes matching any subdomain. An
+// empty list means imports from any registry are allowed.
+func (s *SysContext) AllowedSourceRegistries() []string {
+	raw, ok := s.OperatorConfig()["allowedSourceRegistries"]
+	if !ok {
+		return nil
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(raw, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// ValidateSourceRegistry verifies the registry domain serving the provided source
+// reference belongs to the cluster configured allowlist, see AllowedSourceRegistries.
+// Unqualified references may end up satisfied by any of the configured unqualified
+// registries so all of them must be allowed. This is a security control enforced at
+// admission, rejections here carry a message pointing at the offending domain.
+func (s *SysContext) ValidateSourceRegistry(ctx context.Context, from string) error {
+	allowed := s.AllowedSourceRegistries()
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	domains := []string{}
+	if domain, _ := splitRegistryDomain(from); domain != "" {
+		domains = append(domains, domain)
+	} else {
+		registries, err := s.UnqualifiedRegistries(ctx)
+		if err != nil {
+			return err
+		}
+		domains = registries
+	}
+
+	for _, domain := range domains {
+		if !domainMatchesAny(domain, allowed) {
+			return fmt.Errorf(
+				"registry %q not present in allowedSourceRegistries", domain,
+			)
+		}
+	}
+	return nil
+}
+
+// DefaultMaxManifestUnknownFailures is how many consecutive "manifest unknown" failures
+// an ImageImport gets before we give up on it early, when the operator config does not
+// say otherwise.
+const DefaultMaxManifestUnknownFailures = 3
+
+// MaxManifestUnknownFailures returns how many consecutive "manifest unknown" failures an
+// ImageImport is allowed before we stop retrying it ahead of the regular attempt limit,
+// the "maxManifestUnknownFailures" operator config property. An upstream tag that has
+// been deleted never comes back by retrying, this saves the pointless registry calls.
+// Zero disables the early stop, invalid values fall back to the default.
+func (s *SysContext) MaxManifestUnknownFailures() int {
+	raw, ok := s.OperatorConfig()["maxManifestUnknownFailures"]
+	if !ok {
+		return DefaultMaxManifestUnknownFailures
+	}
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		klog.Warningf(
+			"invalid maxManifestUnknownFailures %q in operator config, using default",
+			raw,
+		)
+		return DefaultMaxManifestUnknownFailures
+	}
+	return parsed
+}
+
+// InternalRegistryDomains returns the registry domains for which the pod service account
+// token should be presented as registry identity token. Useful when importing from the
+// cluster internal registry, where the SA token is a valid credential and no docker config
+// secret exists. Configured through the "internalRegistryDomains" property of the operator
+// ConfigMap, a comma separated list of domains.
+func (s *SysContext) InternalRegistryDomains() []string {
+	raw, ok := s.OperatorConfig()["internalRegistryDomains"]
+	if !ok {
+		return nil
+	}
+
+	var domains []string
+	for _, domain := range strings.Split(raw, ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// DefaultTagFor returns the tag applied to image references that do not specify one. Each
+// namespace may configure its own default through the "defaultTag" property of a local
+// "tagger-config" ConfigMap, falling back to the operator wide config and ultimately to
+// "latest" as per container conventions.
+func (s *SysContext) DefaultTagFor(namespace string) string {
+	if namespace != "" && namespace != os.Getenv("POD_NAMESPACE") {
+		if cm, err := s.cmlister.ConfigMaps(namespace).Get("tagger-config"); err == nil {
+			if tag := cm.Data["defaultTag"]; tag != "" {
+				return tag
+			}
+		}
+	}
+
+	if tag := s.OperatorConfig()["defaultTag"]; tag != "" {
+		return tag
+	}
+	return "latest"
+}
+
+// RecreateMissingImages returns if ImageImports whose target Image no longer exists should
+// recreate it. This is the default behavior, users treating Images as explicitly managed
+// objects may set "onMissingTargetImage" to "fail" in the operator ConfigMap and have such
+// imports error out instead.
+func (s *SysContext) RecreateMissingImages() bool {
+	return s.OperatorConfig()["onMissingTargetImage"] != "fail"
+}
+
+// RejectMirrorLoops returns if imports whose source is their own repository inside the
+// mirror registry should fail. By default such imports skip the mirror stage and record
+// the source reference directly, copying an image onto itself serves no purpose. Setting
+// "onMirrorLoop" to "fail" in the operator ConfigMap rejects them instead.
+func (s *SysContext) RejectMirrorLoops() bool {
+	return s.OperatorConfig()["onMirrorLoop"] == "fail"
+}
+
+// MirrorConfig returns the mirror configuration to be used for images hosted in the provided
+// namespace. Namespaces may carry their own mirror credentials, when they don't we fall back
+// to the operator namespace config or to the kube-public namespace as per KEP.
+func (s *SysContext) MirrorConfig(namespace string) (MirrorRegistryConfig, error) {
 	var errors *multierror.Error
-	taggercfg, err := s.ParseTaggerMirrorRegistryConfig()
+	taggercfg, err := s.ParseTaggerMirrorRegistryConfigFor(namespace)
 	if err == nil {
+		if err := taggercfg.Validate(); err != nil {
+			return MirrorRegistryConfig{}, err
+		}
 		return taggercfg, nil
 	}
 	multierror.Append(errors, err)
@@ -166,6 +554,31 @@ func (s *SysContext) ParseTaggerMirrorRegistryConfig() (MirrorRegistryConfig, er
 	if len(namespace) == 0 {
 		return zero, fmt.Errorf("unbound POD_NAMESPACE variable")
 	}
+	return s.parseMirrorRegistryConfigSecret(namespace)
+}
+
+// ParseTaggerMirrorRegistryConfigFor returns the mirror registry config to be used for the
+// provided namespace. In multi tenant setups each namespace may provide its own mirror
+// credentials through a local "mirror-registry-config" secret (e.g. pushing to tenant
+// specific repositories), when no such secret exists we fall back to the config hosted in
+// the operator namespace.
+func (s *SysContext) ParseTaggerMirrorRegistryConfigFor(
+	namespace string,
+) (MirrorRegistryConfig, error) {
+	if namespace != "" && namespace != os.Getenv("POD_NAMESPACE") {
+		if cfg, err := s.parseMirrorRegistryConfigSecret(namespace); err == nil {
+			return cfg, nil
+		}
+	}
+	return s.ParseTaggerMirrorRegistryConfig()
+}
+
+// parseMirrorRegistryConfigSecret reads and parses the "mirror-registry-config" secret in
+// the provided namespace.
+func (s *SysContext) parseMirrorRegistryConfigSecret(
+	namespace string,
+) (MirrorRegistryConfig, error) {
+	var zero MirrorRegistryConfig
 
 	sct, err := s.sclister.Secrets(namespace).Get("mirror-registry-config")
 	if err != nil {
@@ -175,13 +588,24 @@ func (s *SysContext) ParseTaggerMirrorRegistryConfig() (MirrorRegistryConfig, er
 		return zero, fmt.Errorf("registry config is empty")
 	}
 
+	var maxpar uint
+	if val, ok := sct.Data["maxParallelDownloads"]; ok {
+		parsed, err := strconv.ParseUint(string(val), 10, 32)
+		if err != nil {
+			return zero, fmt.Errorf("invalid maxParallelDownloads in config: %w", err)
+		}
+		maxpar = uint(parsed)
+	}
+
 	return MirrorRegistryConfig{
-		Address:    string(sct.Data["address"]),
-		Username:   string(sct.Data["username"]),
-		Password:   string(sct.Data["password"]),
-		Repository: string(sct.Data["repository"]),
-		Token:      string(sct.Data["token"]),
-		Insecure:   string(sct.Data["insecure"]) == "true",
+		Address:              string(sct.Data["address"]),
+		Username:             string(sct.Data["username"]),
+		Password:             string(sct.Data["password"]),
+		Repository:           string(sct.Data["repository"]),
+		Token:                string(sct.Data["token"]),
+		Insecure:             string(sct.Data["insecure"]) == "true",
+		MaxParallelDownloads: maxpar,
+		PreCreateAPI:         string(sct.Data["preCreateAPI"]),
 	}, nil
 }
 
@@ -209,9 +633,11 @@ func (s *SysContext) MirrorRegistryAddresses() (string, string, error) {
 }
 
 // MirrorRegistryContext returns the context to be used when talking to the the registry used
-// for mirroring images.
-func (s *SysContext) MirrorRegistryContext(ctx context.Context) *types.SystemContext {
-	cfg, err := s.ParseTaggerMirrorRegistryConfig()
+// for mirroring images on behalf of the provided namespace.
+func (s *SysContext) MirrorRegistryContext(
+	ctx context.Context, namespace string,
+) *types.SystemContext {
+	cfg, err := s.ParseTaggerMirrorRegistryConfigFor(namespace)
 	if err != nil {
 		klog.Infof("unable to read tagger mirror registry config: %s", err)
 	}
@@ -249,7 +675,7 @@ func (s *SysContext) SystemContextsFor(
 	if err != nil {
 		klog.Infof("no mirror registry configured, moving on")
 	} else if regaddr == domain {
-		mirrorctx := s.MirrorRegistryContext(ctx)
+		mirrorctx := s.MirrorRegistryContext(ctx, namespace)
 		return []*types.SystemContext{mirrorctx}, nil
 	}
 
@@ -285,6 +711,60 @@ func (s *SysContext) SystemContextsFor(
 	return ctxs, nil
 }
 
+// AuthSource describes one authentication SystemContextsFor would attempt when reaching the
+// registry hosting an image reference. It carries the secret name, never the credentials, so
+// it is safe to print.
+type AuthSource struct {
+	Type   string
+	Secret string
+}
+
+// AuthSourcesFor reports, in order, which authentications would be attempted when importing
+// the provided image reference on behalf of a namespace. The returned slice mirrors what
+// SystemContextsFor builds but carries secret names only, credentials are never exposed.
+func (s *SysContext) AuthSourcesFor(
+	ctx context.Context, imgref types.ImageReference, namespace string,
+) ([]AuthSource, error) {
+	domain := reference.Domain(imgref.DockerReference())
+	if regaddr, _, err := s.MirrorRegistryAddresses(); err == nil && regaddr == domain {
+		return []AuthSource{{Type: "mirror registry config"}}, nil
+	}
+
+	secrets, err := s.sclister.Secrets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("fail to list secrets: %w", err)
+	}
+
+	var sources []AuthSource
+	for _, sec := range secrets {
+		if sec.Type != corev1.SecretTypeDockerConfigJson {
+			continue
+		}
+
+		secdata, ok := sec.Data[corev1.DockerConfigJsonKey]
+		if !ok {
+			continue
+		}
+
+		var cfg dockerAuthConfig
+		if err := json.Unmarshal(secdata, &cfg); err != nil {
+			continue
+		}
+
+		if _, ok := cfg.Auths[domain]; !ok {
+			continue
+		}
+		sources = append(sources, AuthSource{Type: "secret", Secret: sec.Name})
+	}
+
+	if s.serviceAccountAuthFor(domain) != nil {
+		sources = append(sources, AuthSource{Type: "service account token"})
+	}
+
+	// imports always fall back to an anonymous attempt, see SystemContextsFor.
+	return append(sources, AuthSource{Type: "anonymous"}), nil
+}
+
 // authsFor return configured authentications for the registry hosting the image reference.
 // Namespace is the namespace from where read docker authentications.
 func (s *SysContext) authsFor(
@@ -300,6 +780,7 @@ func (s *SysContext) authsFor(
 		return nil, nil
 	}
 
+	var matches []string
 	var dockerAuths []*types.DockerAuthConfig
 	for _, sec := range secrets {
 		if sec.Type != corev1.SecretTypeDockerConfigJson {
@@ -317,16 +798,57 @@ func (s *SysContext) authsFor(
 			continue
 		}
 
-		sec, ok := cfg.Auths[domain]
+		auth, ok := cfg.Auths[domain]
 		if !ok {
 			continue
 		}
 
-		dockerAuths = append(dockerAuths, &sec)
+		matches = append(matches, sec.Name)
+		dockerAuths = append(dockerAuths, &auth)
+	}
+
+	if len(matches) > 1 {
+		klog.Warningf(
+			"multiple credentials for registry %s found in namespace %s (secrets %s)",
+			domain, namespace, strings.Join(matches, ", "),
+		)
+		if s.FailOnCredentialConflict() {
+			return nil, fmt.Errorf(
+				"multiple credentials for registry %s found in secrets %s, "+
+					"remove the ambiguity or unset onCredentialConflict",
+				domain, strings.Join(matches, ", "),
+			)
+		}
+	}
+
+	if auth := s.serviceAccountAuthFor(domain); auth != nil {
+		dockerAuths = append(dockerAuths, auth)
 	}
 	return dockerAuths, nil
 }
 
+// serviceAccountAuthFor returns an authentication bearing the pod service account token as
+// identity token if the provided domain is configured as an internal registry domain. For
+// any other domain this returns nil, the SA token is never presented to registries we were
+// not explicitly told to trust with it.
+func (s *SysContext) serviceAccountAuthFor(domain string) *types.DockerAuthConfig {
+	for _, idom := range s.InternalRegistryDomains() {
+		if idom != domain {
+			continue
+		}
+
+		token, err := ioutil.ReadFile(ServiceAccountTokenPath)
+		if err != nil {
+			klog.Warningf("unable to read service account token: %s", err)
+			return nil
+		}
+		return &types.DockerAuthConfig{
+			IdentityToken: strings.TrimSpace(string(token)),
+		}
+	}
+	return nil
+}
+
 // DefaultPolicyContext returns the default policy context. XXX this should be reviewed.
 func (s *SysContext) DefaultPolicyContext() (*signature.PolicyContext, error) {
 	pol := &signature.Policy{
@@ -338,20 +860,89 @@ func (s *SysContext) DefaultPolicyContext() (*signature.PolicyContext, error) {
 }
 
 // GetRegistryStore creates an instance of an Registry store entity configured to use our mirror
-// registry as underlying storage.
-func (s *SysContext) GetRegistryStore(ctx context.Context) (*imagestore.Registry, error) {
+// registry as underlying storage. Credentials are resolved on behalf of the provided namespace,
+// falling back to the operator namespace config.
+func (s *SysContext) GetRegistryStore(
+	ctx context.Context, namespace string,
+) (*imagestore.Registry, error) {
 	defpol, err := s.DefaultPolicyContext()
 	if err != nil {
 		return nil, fmt.Errorf("error reading default policy: %w", err)
 	}
 
-	mcfg, err := s.MirrorConfig()
+	mcfg, err := s.MirrorConfig(namespace)
 	if err != nil {
 		return nil, fmt.Errorf("unable to acccess mirror: %w", err)
 	}
 
-	sysctx := s.MirrorRegistryContext(ctx)
-	return imagestore.NewRegistry(mcfg.Address, mcfg.Repository, sysctx, defpol), nil
+	opts := []imagestore.RegistryOption{
+		imagestore.WithMaxParallelDownloads(mcfg.MaxParallelDownloads),
+	}
+
+	// some registries refuse pushes into repositories that do not exist yet, for these
+	// we support creating the repository through the registry's own API ahead of the
+	// push. Only Harbor is supported at this time.
+	switch mcfg.PreCreateAPI {
+	case "":
+	case "harbor":
+		opts = append(opts, imagestore.WithRepositoryPreCreator(
+			imagestore.NewHarborPreCreator(
+				mcfg.Address, mcfg.Username, mcfg.Password, mcfg.Insecure,
+			),
+		))
+	default:
+		klog.Warningf("unsupported preCreateAPI %q, ignoring", mcfg.PreCreateAPI)
+	}
+
+	sysctx := s.MirrorRegistryContext(ctx, namespace)
+	return imagestore.NewRegistry(
+		mcfg.Address,
+		mcfg.Repository,
+		sysctx,
+		defpol,
+		opts...,
+	), nil
+}
+
+// MirrorWritable verifies tagger can actually push images into the configured mirror registry
+// by means of a tiny test push. Returns nil when no mirror is configured as there is nothing
+// to be verified in this case.
+func (s *SysContext) MirrorWritable(ctx context.Context) error {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if _, err := s.MirrorConfig(namespace); err != nil {
+		return nil
+	}
+
+	store, err := s.GetRegistryStore(ctx, namespace)
+	if err != nil {
+		return fmt.Errorf("unable to access mirror: %w", err)
+	}
+	return store.Writable(ctx)
+}
+
+// sanitizeRegistries trims, deduplicates and validates a list of registry addresses. Entries
+// that are not parseable as a registry host are skipped with a warning, we rather attempt an
+// import with the remaining registries than fail oddly down the road due to a misconfigured
+// entry.
+func sanitizeRegistries(registries []string) []string {
+	seen := map[string]bool{}
+	valid := make([]string, 0, len(registries))
+	for _, registry := range registries {
+		registry = strings.TrimSpace(registry)
+		if registry == "" || seen[registry] {
+			continue
+		}
+
+		refstr := fmt.Sprintf("docker://%s/tagger", registry)
+		if _, err := alltransports.ParseImageName(refstr); err != nil {
+			klog.Warningf("skipping invalid registry %q: %s", registry, err)
+			continue
+		}
+
+		seen[registry] = true
+		valid = append(valid, registry)
+	}
+	return valid
 }
 
 // RegistriesToSearch returns a list of registries to be used when looking for an image. It is
@@ -369,8 +960,12 @@ func (s *SysContext) RegistriesToSearch(ctx context.Context, domain string) ([]s
 		return nil, err
 	}
 
+	registries = sanitizeRegistries(registries)
 	if len(registries) == 0 {
 		return nil, fmt.Errorf("no unqualified registries found")
 	}
-	return registries, nil
+
+	// registries with a better recent track record go first so a persistently
+	// down mirror does not make every resolution wait for its timeout.
+	return s.sortByRegistryHealth(registries), nil
 }
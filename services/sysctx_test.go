@@ -17,6 +17,9 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -204,3 +207,654 @@ func Test_authsFor(t *testing.T) {
 		})
 	}
 }
+
+func Test_sanitizeRegistries(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		regs []string
+		exp  []string
+	}{
+		{
+			name: "empty list",
+			regs: []string{},
+			exp:  []string{},
+		},
+		{
+			name: "duplicated entries",
+			regs: []string{"docker.io", "quay.io", "docker.io"},
+			exp:  []string{"docker.io", "quay.io"},
+		},
+		{
+			name: "entries with surrounding spaces",
+			regs: []string{" docker.io ", "docker.io"},
+			exp:  []string{"docker.io"},
+		},
+		{
+			name: "malformed entries are skipped",
+			regs: []string{"in valid", "UPPERCASE", "quay.io"},
+			exp:  []string{"quay.io"},
+		},
+		{
+			name: "registry with port",
+			regs: []string{"localhost:5000", ""},
+			exp:  []string{"localhost:5000"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res := sanitizeRegistries(tt.regs)
+			if len(res) != len(tt.exp) {
+				t.Fatalf("expected %v, received %v", tt.exp, res)
+			}
+			for i := range res {
+				if res[i] != tt.exp[i] {
+					t.Fatalf("expected %v, received %v", tt.exp, res)
+				}
+			}
+		})
+	}
+}
+
+func Test_RecreateMissingImages(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  map[string]string
+		exp  bool
+	}{
+		{
+			name: "no config",
+			exp:  true,
+		},
+		{
+			name: "explicit recreate",
+			cfg:  map[string]string{"onMissingTargetImage": "recreate"},
+			exp:  true,
+		},
+		{
+			name: "fail on missing image",
+			cfg:  map[string]string{"onMissingTargetImage": "fail"},
+			exp:  false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var objects []runtime.Object
+			if tt.cfg != nil {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: tt.cfg,
+				})
+			}
+
+			corcli := fake.NewSimpleClientset(objects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			syssvc := NewSysContext(corinf)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			if res := syssvc.RecreateMissingImages(); res != tt.exp {
+				t.Errorf("expecting %v, received %v", tt.exp, res)
+			}
+		})
+	}
+}
+
+func TestMirrorRegistryConfigValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  MirrorRegistryConfig
+		err  string
+	}{
+		{
+			name: "missing address",
+			cfg: MirrorRegistryConfig{
+				Username: "user",
+				Password: "pass",
+			},
+			err: "missing address",
+		},
+		{
+			name: "username without password",
+			cfg: MirrorRegistryConfig{
+				Address:  "registry.io",
+				Username: "user",
+			},
+			err: "missing password",
+		},
+		{
+			name: "password without username",
+			cfg: MirrorRegistryConfig{
+				Address:  "registry.io",
+				Password: "pass",
+			},
+			err: "missing username",
+		},
+		{
+			name: "anonymous config",
+			cfg: MirrorRegistryConfig{
+				Address: "registry.io",
+			},
+		},
+		{
+			name: "full config",
+			cfg: MirrorRegistryConfig{
+				Address:    "registry.io",
+				Username:   "user",
+				Password:   "pass",
+				Repository: "tagger",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if err != nil {
+				if tt.err == "" {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting %q in error %q", tt.err, err)
+				}
+				return
+			}
+			if tt.err != "" {
+				t.Errorf("expecting error %q, nil received", tt.err)
+			}
+		})
+	}
+}
+
+func Test_serviceAccountAuthFor(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		domains string
+		domain  string
+		token   string
+		expauth bool
+	}{
+		{
+			name:    "no internal domains configured",
+			domain:  "registry.internal.svc:5000",
+			token:   "sa-token",
+			expauth: false,
+		},
+		{
+			name:    "domain not configured as internal",
+			domains: "registry.internal.svc:5000",
+			domain:  "quay.io",
+			token:   "sa-token",
+			expauth: false,
+		},
+		{
+			name:    "configured internal domain",
+			domains: "registry.internal.svc:5000,other.svc:5000",
+			domain:  "registry.internal.svc:5000",
+			token:   "sa-token",
+			expauth: true,
+		},
+		{
+			name:    "token file not found",
+			domains: "registry.internal.svc:5000",
+			domain:  "registry.internal.svc:5000",
+			expauth: false,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			tokenpath := ServiceAccountTokenPath
+			defer func() { ServiceAccountTokenPath = tokenpath }()
+			ServiceAccountTokenPath = filepath.Join(t.TempDir(), "token")
+			if tt.token != "" {
+				if err := ioutil.WriteFile(
+					ServiceAccountTokenPath, []byte(tt.token+"\n"), 0600,
+				); err != nil {
+					t.Fatalf("unexpected error writing token: %s", err)
+				}
+			}
+
+			var objects []runtime.Object
+			if tt.domains != "" {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: map[string]string{
+						"internalRegistryDomains": tt.domains,
+					},
+				})
+			}
+
+			corcli := fake.NewSimpleClientset(objects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			syssvc := NewSysContext(corinf)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			auth := syssvc.serviceAccountAuthFor(tt.domain)
+			if !tt.expauth {
+				if auth != nil {
+					t.Errorf("unexpected auth %+v", auth)
+				}
+				return
+			}
+			if auth == nil {
+				t.Fatal("expecting an auth, nil received")
+			}
+			if auth.IdentityToken != tt.token {
+				t.Errorf("expecting token %q, %q found", tt.token, auth.IdentityToken)
+			}
+		})
+	}
+}
+
+func Test_CredentialProbeParallelism(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		cfg  map[string]string
+		exp  int
+	}{
+		{
+			name: "no config",
+			exp:  1,
+		},
+		{
+			name: "explicit opt in",
+			cfg:  map[string]string{"credentialProbeParallelism": "4"},
+			exp:  4,
+		},
+		{
+			name: "invalid value",
+			cfg:  map[string]string{"credentialProbeParallelism": "a lot"},
+			exp:  1,
+		},
+		{
+			name: "zero is not a parallelism",
+			cfg:  map[string]string{"credentialProbeParallelism": "0"},
+			exp:  1,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var objects []runtime.Object
+			if tt.cfg != nil {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: tt.cfg,
+				})
+			}
+
+			corcli := fake.NewSimpleClientset(objects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			syssvc := NewSysContext(corinf)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			if res := syssvc.CredentialProbeParallelism(); res != tt.exp {
+				t.Errorf("expecting %d, received %d", tt.exp, res)
+			}
+		})
+	}
+}
+
+func Test_AuthSourcesFor(t *testing.T) {
+	auths, _ := json.Marshal(
+		dockerAuthConfig{
+			Auths: map[string]types.DockerAuthConfig{
+				"docker.io": {
+					Username: "user",
+					Password: "pass",
+				},
+			},
+		},
+	)
+
+	for _, tt := range []struct {
+		name    string
+		image   string
+		objects []runtime.Object
+		exp     []AuthSource
+	}{
+		{
+			name:  "no secrets fall back to anonymous",
+			image: "centos:latest",
+			exp: []AuthSource{
+				{Type: "anonymous"},
+			},
+		},
+		{
+			name:  "matching secret reported by name",
+			image: "centos:latest",
+			objects: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "regcred",
+					},
+					Type: corev1.SecretTypeDockerConfigJson,
+					Data: map[string][]byte{
+						corev1.DockerConfigJsonKey: auths,
+					},
+				},
+			},
+			exp: []AuthSource{
+				{Type: "secret", Secret: "regcred"},
+				{Type: "anonymous"},
+			},
+		},
+		{
+			name:  "secret for another registry is not reported",
+			image: "registry.io/repo/image:latest",
+			objects: []runtime.Object{
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "default",
+						Name:      "regcred",
+					},
+					Type: corev1.SecretTypeDockerConfigJson,
+					Data: map[string][]byte{
+						corev1.DockerConfigJsonKey: auths,
+					},
+				},
+			},
+			exp: []AuthSource{
+				{Type: "anonymous"},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			fakecli := fake.NewSimpleClientset(tt.objects...)
+			informer := coreinf.NewSharedInformerFactory(fakecli, time.Minute)
+
+			sysctx := NewSysContext(informer)
+
+			informer.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				informer.Core().V1().Secrets().Informer().HasSynced,
+				informer.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			ref, _ := reference.ParseDockerRef(tt.image)
+			imgref, _ := docker.NewReference(ref)
+
+			sources, err := sysctx.AuthSourcesFor(ctx, imgref, "default")
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+
+			if !reflect.DeepEqual(sources, tt.exp) {
+				t.Errorf("expecting %+v, received %+v", tt.exp, sources)
+			}
+		})
+	}
+}
+
+func Test_sortByRegistryHealth(t *testing.T) {
+	syssvc := NewSysContext(nil)
+
+	registries := []string{"first.io", "second.io", "third.io"}
+
+	// with no outcomes recorded the configured order is preserved.
+	sorted := syssvc.sortByRegistryHealth(append([]string{}, registries...))
+	if !reflect.DeepEqual(sorted, registries) {
+		t.Errorf("expecting configured order, received %v", sorted)
+	}
+
+	// a failing registry sinks to the end of the list.
+	syssvc.RecordRegistryOutcome("first.io", false)
+	sorted = syssvc.sortByRegistryHealth(append([]string{}, registries...))
+	exp := []string{"second.io", "third.io", "first.io"}
+	if !reflect.DeepEqual(sorted, exp) {
+		t.Errorf("expecting %v, received %v", exp, sorted)
+	}
+
+	// a succeeding registry raises to the top of the list.
+	syssvc.RecordRegistryOutcome("third.io", true)
+	sorted = syssvc.sortByRegistryHealth(append([]string{}, registries...))
+	exp = []string{"third.io", "second.io", "first.io"}
+	if !reflect.DeepEqual(sorted, exp) {
+		t.Errorf("expecting %v, received %v", exp, sorted)
+	}
+
+	// scores are bounded, a long streak of failures is forgotten as soon as the
+	// registry flips back to succeeding for a while.
+	for i := 0; i < 20; i++ {
+		syssvc.RecordRegistryOutcome("first.io", false)
+	}
+	if score := syssvc.RegistryScore("first.io"); score != -registryHealthScoreCap {
+		t.Errorf("expecting score %d, received %d", -registryHealthScoreCap, score)
+	}
+	for i := 0; i < 2*registryHealthScoreCap; i++ {
+		syssvc.RecordRegistryOutcome("first.io", true)
+	}
+	if score := syssvc.RegistryScore("first.io"); score != registryHealthScoreCap {
+		t.Errorf("expecting score %d, received %d", registryHealthScoreCap, score)
+	}
+}
+
+func Test_ValidateSourceRegistry(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		allowed string
+		from    string
+		err     string
+	}{
+		{
+			name: "no allowlist configured",
+			from: "quay.io/repo/image:latest",
+		},
+		{
+			name:    "allowed domain",
+			allowed: "quay.io,registry.io",
+			from:    "quay.io/repo/image:latest",
+		},
+		{
+			name:    "denied domain",
+			allowed: "quay.io",
+			from:    "registry.io/repo/image:latest",
+			err:     "not present in allowedSourceRegistries",
+		},
+		{
+			name:    "wildcard subdomain allowed",
+			allowed: "*.corp.example",
+			from:    "registry.corp.example/repo/image:latest",
+		},
+		{
+			name:    "unqualified reference against allowed registries",
+			allowed: "docker.io",
+			from:    "centos:latest",
+		},
+		{
+			name:    "unqualified reference against denied registries",
+			allowed: "quay.io",
+			from:    "centos:latest",
+			err:     "not present in allowedSourceRegistries",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			var objects []runtime.Object
+			if tt.allowed != "" {
+				objects = append(objects, &corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: map[string]string{
+						"allowedSourceRegistries": tt.allowed,
+					},
+				})
+			}
+
+			corcli := fake.NewSimpleClientset(objects...)
+			corinf := coreinf.NewSharedInformerFactory(corcli, time.Minute)
+
+			syssvc := NewSysContext(corinf)
+
+			corinf.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				corinf.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			err := syssvc.ValidateSourceRegistry(ctx, tt.from)
+			if err != nil {
+				if tt.err == "" {
+					t.Errorf("unexpected error: %s", err)
+				} else if !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting %q in error %q", tt.err, err)
+				}
+				return
+			}
+			if tt.err != "" {
+				t.Errorf("expecting error %q, nil received", tt.err)
+			}
+		})
+	}
+}
+
+func Test_authsForCredentialConflict(t *testing.T) {
+	auths, _ := json.Marshal(
+		dockerAuthConfig{
+			Auths: map[string]types.DockerAuthConfig{
+				"docker.io": {
+					Username: "user",
+					Password: "pass",
+				},
+			},
+		},
+	)
+	secretFor := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+			},
+			Type: corev1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{
+				corev1.DockerConfigJsonKey: auths,
+			},
+		}
+	}
+
+	for _, tt := range []struct {
+		name       string
+		cfg        map[string]string
+		err        string
+		authsCount int
+	}{
+		{
+			name:       "conflicting credentials are all tried by default",
+			authsCount: 2,
+		},
+		{
+			name:       "conflicting credentials are all tried when opted in",
+			cfg:        map[string]string{"onCredentialConflict": "tryAll"},
+			authsCount: 2,
+		},
+		{
+			name: "conflicting credentials fail fast when configured",
+			cfg:  map[string]string{"onCredentialConflict": "fail"},
+			err:  "multiple credentials for registry docker.io",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			t.Setenv("POD_NAMESPACE", "tagger")
+
+			objects := []runtime.Object{
+				secretFor("secret"),
+				secretFor("another-secret"),
+				&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{
+						Namespace: "tagger",
+						Name:      "tagger-config",
+					},
+					Data: tt.cfg,
+				},
+			}
+
+			fakecli := fake.NewSimpleClientset(objects...)
+			informer := coreinf.NewSharedInformerFactory(fakecli, time.Minute)
+
+			sysctx := NewSysContext(informer)
+
+			informer.Start(ctx.Done())
+			if !cache.WaitForCacheSync(
+				ctx.Done(),
+				informer.Core().V1().Secrets().Informer().HasSynced,
+				informer.Core().V1().ConfigMaps().Informer().HasSynced,
+			) {
+				t.Fatal("errors waiting for caches to sync")
+			}
+
+			ref, _ := reference.ParseDockerRef("centos:latest")
+			imgref, _ := docker.NewReference(ref)
+
+			auths, err := sysctx.authsFor(ctx, imgref, "default")
+			if len(tt.err) > 0 {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("expecting error %q, %v received", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(auths) != tt.authsCount {
+				t.Errorf("expecting %d, %d received", tt.authsCount, len(auths))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Tagger Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/containers/image/v5/transports/alltransports"
+)
+
+// MirrorVerificationWorkers caps how many mirror manifest checks VerifyMirror runs in
+// parallel. Checks are network bound so a handful of workers keeps runs fast without
+// hammering the mirror registry.
+var MirrorVerificationWorkers = 5
+
+// MirrorDrift points to a mirrored Image whose current reference does not resolve in the
+// mirror registry anymore. Reason carries the error found while fetching the manifest.
+type MirrorDrift struct {
+	Namespace string
+	Name      string
+	Reference string
+	Reason    string
+}
+
+// VerifyMirror checks that the current reference of every mirrored Image still resolves
+// in the mirror registry, i.e. that a manifest fetch for it succeeds. Mirror garbage
+// collection or configuration drift may leave Images pointing to references the mirror
+// no longer serves, this composes a report of such cases. An empty namespace verifies
+// Images in all namespaces. Checks run in parallel, capped by MirrorVerificationWorkers.
+func (t *Image) VerifyMirror(ctx context.Context, namespace string) ([]MirrorDrift, error) {
+	imgs, err := t.imglis.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("unable to list images: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	var mtx sync.Mutex
+	var drifts []MirrorDrift
+	tokens := make(chan struct{}, MirrorVerificationWorkers)
+	for _, img := range imgs {
+		if namespace != "" && img.Namespace != namespace {
+			continue
+		}
+		if !img.Spec.Mirror || len(img.Status.HashReferences) == 0 {
+			continue
+		}
+
+		img := img
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-tokens }()
+
+			refstr := img.CurrentReferenceForImage()
+			if err := t.mirrorServesReference(ctx, refstr, img.Namespace); err != nil {
+				mtx.Lock()
+				drifts = append(drifts, MirrorDrift{
+					Namespace: img.Namespace,
+					Name:      img.Name,
+					Reference: refstr,
+					Reason:    err.Error(),
+				})
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Namespace != drifts[j].Namespace {
+			return drifts[i].Namespace < drifts[j].Namespace
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	return drifts, nil
+}
+
+// mirrorServesReference attempts to fetch the manifest for the provided image reference
+// from the mirror registry configured for the namespace, returning nil when the mirror
+// still serves it.
+func (t *Image) mirrorServesReference(
+	ctx context.Context, refstr string, namespace string,
+) error {
+	imgref, err := alltransports.ParseImageName(fmt.Sprintf("docker://%s", refstr))
+	if err != nil {
+		return fmt.Errorf("invalid image reference: %w", err)
+	}
+
+	sysctx := t.syssvc.MirrorRegistryContext(ctx, namespace)
+	src, err := imgref.NewImageSource(ctx, sysctx)
+	if err != nil {
+		return fmt.Errorf("unable to access image: %w", err)
+	}
+	defer src.Close()
+
+	if _, _, err := src.GetManifest(ctx, nil); err != nil {
+		return fmt.Errorf("unable to fetch manifest: %w", err)
+	}
+	return nil
+}